@@ -17,4 +17,15 @@ class ProblemEnvironment < ApplicationRecord
 
   belongs_to :team, optional: true
   belongs_to :problem
+  has_many :status_transitions, dependent: :delete_all, class_name: 'ProblemEnvironmentStatusTransition'
+
+  after_save :record_status_transition, if: :saved_change_to_status?
+
+  def record_status_transition
+    from_status, to_status = saved_change_to_status
+    # statusをnilに戻す場合は記録しない
+    return if to_status.nil?
+
+    status_transitions.create!(from_status: from_status, to_status: to_status)
+  end
 end
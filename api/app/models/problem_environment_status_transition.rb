@@ -0,0 +1,11 @@
+# frozen_string_literal: true
+
+# ProblemEnvironmentのstatusの変更履歴
+# vmdb-apiからも記録される
+class ProblemEnvironmentStatusTransition < ApplicationRecord
+  validates :from_status,         presence: false
+  validates :to_status,           presence: true
+  validates :problem_environment, presence: true
+
+  belongs_to :problem_environment
+end
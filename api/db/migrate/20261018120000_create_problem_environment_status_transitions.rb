@@ -0,0 +1,10 @@
+class CreateProblemEnvironmentStatusTransitions < ActiveRecord::Migration[6.0]
+  def change
+    create_table :problem_environment_status_transitions, id: :uuid do |t|
+      t.string     'from_status',         null: true
+      t.string     'to_status',           null: false
+      t.references :problem_environment, null: false, type: :uuid, index: { name: 'index_pe_status_transitions_on_problem_environment_id' }
+      t.timestamps                        null: false
+    end
+  end
+end
@@ -10,7 +10,7 @@
 #
 # It's strongly recommended that you check this file into your version control system.
 
-ActiveRecord::Schema.define(version: 2023_01_11_122643) do
+ActiveRecord::Schema.define(version: 2026_10_18_120000) do
 
   # These are extensions that must be enabled in order to support this database
   enable_extension "pgcrypto"
@@ -128,6 +128,15 @@ ActiveRecord::Schema.define(version: 2023_01_11_122643) do
     t.index ["problem_id"], name: "index_problem_bodies_on_problem_id"
   end
 
+  create_table "problem_environment_status_transitions", id: :uuid, default: -> { "gen_random_uuid()" }, force: :cascade do |t|
+    t.string "from_status"
+    t.string "to_status", null: false
+    t.uuid "problem_environment_id", null: false
+    t.datetime "created_at", null: false
+    t.datetime "updated_at", null: false
+    t.index ["problem_environment_id"], name: "index_pe_status_transitions_on_problem_environment_id"
+  end
+
   create_table "problem_environments", id: :uuid, default: -> { "gen_random_uuid()" }, force: :cascade do |t|
     t.string "status"
     t.string "host", null: false
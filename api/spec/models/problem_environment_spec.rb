@@ -0,0 +1,37 @@
+# frozen_string_literal: true
+
+require 'rails_helper'
+
+RSpec.describe ProblemEnvironment, type: :model do
+  describe '#record_status_transition' do
+    let(:problem) { create(:problem) }
+    let!(:problem_environment) { create(:problem_environment, problem: problem, team: player1, status: 'UNDER_CHALLENGE') }
+
+    it 'records the initial status on create' do
+      expect(problem_environment.status_transitions.pluck(:from_status, :to_status)).to eq([[nil, 'UNDER_CHALLENGE']])
+    end
+
+    it 'records the transition on status change' do
+      expect { problem_environment.update!(status: 'UNDER_SCORING') }
+        .to change { problem_environment.status_transitions.count }.by(1)
+
+      transition = problem_environment.status_transitions.find_by(to_status: 'UNDER_SCORING')
+      expect(transition.from_status).to eq('UNDER_CHALLENGE')
+    end
+
+    it 'does not record when status is not changed' do
+      expect { problem_environment.update!(host: 'changed.local') }
+        .not_to(change { problem_environment.status_transitions.count })
+    end
+
+    it 'does not record when status changes to nil' do
+      expect { problem_environment.update!(status: nil) }
+        .not_to(change { problem_environment.status_transitions.count })
+    end
+
+    it 'deletes transitions with the problem environment' do
+      expect { problem_environment.destroy! }
+        .to change(ProblemEnvironmentStatusTransition, :count).by(-1)
+    end
+  end
+end
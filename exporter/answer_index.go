@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// watermarkOverlap is subtracted from the watermark when fetching updated Answers.
+// A transaction might be committed after a newer row is visible, so re-fetch a little older rows not to miss it.
+const watermarkOverlap = time.Minute
+
+// answerIndex keeps all Answers in memory, indexed by team and problem.
+// Only Answers (or their Scores) updated after the watermark are fetched in each update,
+// so that the exporter doesn't need to reload the whole answers table every time.
+type answerIndex struct {
+	answers       map[uuid.UUID]Answer
+	byTeamProblem map[teamProblemKey][]uuid.UUID
+	watermark     time.Time
+
+	// idChecksum is the sum of answerIDChecksum of the indexed Answers, compared with AnswersFingerprint.
+	idChecksum int64
+}
+
+func newAnswerIndex() *answerIndex {
+	return &answerIndex{
+		answers:       map[uuid.UUID]Answer{},
+		byTeamProblem: map[teamProblemKey][]uuid.UUID{},
+	}
+}
+
+// update fetches Answers updated after the watermark.
+// If the set of Answers doesn't match the DB (e.g. DB reset, or Answers deleted with their team or problem),
+// it reloads all Answers. Comparing the checksum of IDs as well as the count detects Answers replaced by
+// the same number of other ones, which the watermark alone might miss.
+func (i *answerIndex) update(ctx context.Context, repository *Repository) error {
+	if i.watermark.IsZero() {
+		return i.reload(ctx, repository)
+	}
+
+	answers, err := repository.FindAnswersUpdatedSince(ctx, i.watermark.Add(-watermarkOverlap))
+	if err != nil {
+		return err
+	}
+	for _, answer := range answers {
+		i.upsert(answer)
+	}
+
+	fingerprint, err := repository.FindAnswersFingerprint(ctx)
+	if err != nil {
+		return err
+	}
+	if fingerprint.Count != len(i.answers) || fingerprint.IDChecksum != i.idChecksum {
+		slog.Info("reloading all answers", "indexed", len(i.answers), "actual", fingerprint.Count)
+		return i.reload(ctx, repository)
+	}
+
+	return nil
+}
+
+func (i *answerIndex) reload(ctx context.Context, repository *Repository) error {
+	answers, err := repository.FindAnswers(ctx)
+	if err != nil {
+		return err
+	}
+
+	*i = *newAnswerIndex()
+	for _, answer := range answers {
+		i.upsert(answer)
+	}
+
+	return nil
+}
+
+func (i *answerIndex) upsert(answer Answer) {
+	if _, ok := i.answers[answer.ID]; !ok {
+		key := teamProblemKey{TeamID: answer.TeamID, ProblemID: answer.ProblemID}
+		i.byTeamProblem[key] = append(i.byTeamProblem[key], answer.ID)
+		i.idChecksum += answerIDChecksum(answer.ID)
+	}
+	i.answers[answer.ID] = answer
+
+	if answer.UpdatedAt.After(i.watermark) {
+		i.watermark = answer.UpdatedAt.UTC()
+	}
+}
+
+// answersFor returns Answers submitted by the team for the problem.
+func (i *answerIndex) answersFor(teamID, problemID uuid.UUID) []Answer {
+	ids := i.byTeamProblem[teamProblemKey{TeamID: teamID, ProblemID: problemID}]
+
+	answers := make([]Answer, 0, len(ids))
+	for _, id := range ids {
+		answers = append(answers, i.answers[id])
+	}
+	return answers
+}
+
+// has reports whether the Answer is in the index.
+func (i *answerIndex) has(id uuid.UUID) bool {
+	_, ok := i.answers[id]
+	return ok
+}
+
+// all returns all Answers in the index.
+func (i *answerIndex) all() []Answer {
+	answers := make([]Answer, 0, len(i.answers))
+	for _, answer := range i.answers {
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+// answerIDChecksum hashes the Answer ID into int32, in the same way as FindAnswersFingerprint does in SQL.
+func answerIDChecksum(id uuid.UUID) int64 {
+	sum := md5.Sum([]byte(id.String()))
+	return int64(int32(binary.BigEndian.Uint32(sum[:4])))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestAnswerIDChecksum(t *testing.T) {
+	// Expected values are computed by ('x' || substr(md5(id::text), 1, 8))::bit(32)::int in PostgreSQL.
+	tests := []struct {
+		id   string
+		want int64
+	}{
+		{id: "00000000-0000-0000-0000-000000000000", want: -1618360246},
+		{id: "5b3c2e4a-1f0d-4c6b-9a8e-7d2f1e0c3b4a", want: -585056195},
+	}
+	for _, tt := range tests {
+		if got := answerIDChecksum(uuid.MustParse(tt.id)); got != tt.want {
+			t.Errorf("answerIDChecksum(%s) = %d, want %d", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestAnswerIndexUpsertChecksum(t *testing.T) {
+	index := newAnswerIndex()
+	first := Answer{ID: uuid.New()}
+	second := Answer{ID: uuid.New()}
+
+	index.upsert(first)
+	index.upsert(second)
+	// Updating the same Answer must not change the checksum.
+	index.upsert(first)
+
+	want := answerIDChecksum(first.ID) + answerIDChecksum(second.ID)
+	if index.idChecksum != want {
+		t.Errorf("idChecksum = %d, want %d", index.idChecksum, want)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,6 +23,22 @@ var (
 		Name:      "metrics_collect_duration_seconds",
 	})
 
+	collectErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "collect_errors_total",
+	})
+
+	lastSuccessfulCollectTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_collect_timestamp_seconds",
+	})
+
+	// databaseUp is 1 if DB is reachable in the last collection, like `up` of Prometheus.
+	databaseUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_up",
+	})
+
 	// sum(teamsInfo) == teamsTotal
 	teamsInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
@@ -32,7 +52,40 @@ var (
 		Namespace: namespace,
 		Name:      "problems_info",
 	}, []string{
-		"problem_id", "problem_code", "problem_title",
+		"problem_id", "problem_code", "problem_title", "category_id",
+		"problem_genre", "problem_mode", "problem_writer", "problem_resettable",
+	})
+
+	problemPerfectPoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_perfect_point",
+	}, []string{
+		"problem_id",
+	})
+
+	// problemOpened is 1 if the current time is within open_at of the problem, or all_problem_force_open_at has passed.
+	problemOpened = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_opened",
+	}, []string{
+		"problem_id",
+	})
+
+	// problemUnlocked is 1 if the previous problem is solved by the team, or by any team for problems not isolated.
+	// It doesn't take open_at into account, so the problem is visible to the team iff problemOpened * problemUnlocked == 1.
+	problemUnlocked = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_unlocked",
+	}, []string{
+		"team_id", "problem_id",
+	})
+
+	// sum(categoriesInfo) == the number of categories
+	categoriesInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "category_info",
+	}, []string{
+		"category_id", "category_code", "category_title", "category_order",
 	})
 
 	teamsTotal = prometheus.NewGauge(prometheus.GaugeOpts{
@@ -58,11 +111,287 @@ var (
 	}, []string{
 		"team_id", "problem_id",
 	})
+
+	// scorePercents is the percentage of the perfect point of the answer counted in scores.
+	scorePercents = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "score_percents",
+	}, []string{
+		"team_id", "problem_id",
+	})
+
+	// solvedFlags is 1 if the answer counted in scores satisfies solved_criterion of the problem.
+	solvedFlags = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "solved",
+	}, []string{
+		"team_id", "problem_id",
+	})
+
+	penaltiesTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "penalties_total",
+	}, []string{
+		"team_id", "problem_id",
+	})
+
+	// penaltyAdjustedScores is scores plus penalties_total * penalty_weight.
+	// penalty_weight is usually negative, so this is what contestants see in the scoreboard.
+	penaltyAdjustedScores = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "penalty_adjusted_scores",
+	}, []string{
+		"team_id", "problem_id",
+	})
+
+	// teamTotalScore is the sum of penaltyAdjustedScores for each team.
+	teamTotalScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "team_total_score",
+	}, []string{
+		"team_id",
+	})
+
+	// teamRank is ranked in beginner teams and the others independently as the scoreboard does.
+	// Only players except team99 are ranked, even if other teams are exported by --include-teams.
+	teamRank = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "team_rank",
+	}, []string{
+		"team_id",
+	})
+
+	// categoryScores is the sum of scores of problems in each category.
+	categoryScores = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "category_scores",
+	}, []string{
+		"team_id", "category_id",
+	})
+
+	// competitionSection is the 1-origin number of the section in progress, or 0 if no section is in progress.
+	competitionSection = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "competition_section",
+	})
+
+	competitionSectionRemainingSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "competition_section_remaining_seconds",
+	})
+
+	// sectionScoreDeltas is the increase of team_total_score by answers and penalties during each section.
+	// It's 0 for sections not started yet, and increases until the section ends.
+	sectionScoreDeltas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "section_score_deltas",
+	}, []string{
+		"team_id", "section",
+	})
+
+	// problemFirstSolveTimestampSeconds has only one series for each problem, labeled with the first solving team.
+	problemFirstSolveTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_first_solve_timestamp_seconds",
+	}, []string{
+		"problem_id", "team_id",
+	})
+
+	problemSolvedTeams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_solved_teams",
+	}, []string{
+		"problem_id",
+	})
+
+	issuesTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "issues_total",
+	}, []string{
+		"problem_id", "status",
+	})
+
+	// issueOldestUnansweredAgeSeconds is the time since the oldest Issue still waiting for a reply from staff.
+	// An Issue is unanswered from the first comment of the team after the last one from staff until it's solved.
+	issueOldestUnansweredAgeSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "issue_oldest_unanswered_age_seconds",
+	}, []string{
+		"problem_id",
+	})
+
+	// answersSubmittedTotal is counted up when the exporter finds new answers.
+	// Unlike answersTotal, it never decreases even if DB is reset.
+	answersSubmittedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "answers_submitted_total",
+	}, []string{
+		"problem_id",
+	})
+
+	// answerSubmissionIntervalSeconds is the time between consecutive answers from a team for the problem.
+	// It's observed only once for each Answer, when the exporter finds it for the first time.
+	answerSubmissionIntervalSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "answer_submission_interval_seconds",
+		Buckets:   prometheus.ExponentialBuckets(15, 2, 10),
+	}, []string{
+		"problem_id",
+	})
+
+	unscoredAnswers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unscored_answers",
+	}, []string{
+		"problem_id",
+	})
+
+	unscoredAnswerOldestAgeSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unscored_answer_oldest_age_seconds",
+	}, []string{
+		"problem_id",
+	})
+
+	// answerGradingLatencySeconds is observed only once for each Answer, when the exporter finds it graded for the first time.
+	answerGradingLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "answer_grading_latency_seconds",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 8),
+	}, []string{
+		"problem_id",
+	})
+
+	noticesTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "notices_total",
+	}, []string{
+		"pinned", "targeted",
+	})
+
+	// noticeLastPublishedTimestampSeconds is absent for combinations of labels without any notices.
+	noticeLastPublishedTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "notice_last_published_timestamp_seconds",
+	}, []string{
+		"pinned", "targeted",
+	})
+
+	problemSupplementsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_supplements_total",
+	}, []string{
+		"problem_id",
+	})
+
+	// problemSupplementLastPublishedTimestampSeconds is absent for problems without any supplements.
+	problemSupplementLastPublishedTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_supplement_last_published_timestamp_seconds",
+	}, []string{
+		"problem_id",
+	})
+
+	attachmentsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "attachments_total",
+	}, []string{
+		"team_id",
+	})
+
+	attachmentBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "attachment_bytes",
+	}, []string{
+		"team_id",
+	})
+
+	// attachmentQuotaBytes is 0 if the quota is disabled.
+	attachmentQuotaBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "attachment_quota_bytes",
+	})
+
+	attachmentQuotaExceeded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "attachment_quota_exceeded",
+	}, []string{
+		"team_id",
+	})
+
+	// problemEnvironments has an empty status label for problem_environments whose status is NULL.
+	problemEnvironments = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "problem_environments",
+	}, []string{
+		"problem_id", "service", "status",
+	})
+
+	unassignedProblemEnvironments = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unassigned_problem_environments",
+	}, []string{
+		"problem_id", "status",
+	})
 )
 
+// issueStatuses is the enum of Issue.status in the score server.
+var issueStatuses = map[int]string{
+	1: "unsolved",
+	2: "in_progress",
+	3: "solved",
+}
+
+const issueStatusSolved = 3
+
+// problemModes is the enum of ProblemBody.mode in the score server.
+var problemModes = map[int]string{
+	10: "textbox",
+	20: "radio_button",
+	30: "checkbox",
+}
+
+// teamProblemKey is used to index records by the pair of team and problem.
+type teamProblemKey struct {
+	TeamID    uuid.UUID
+	ProblemID uuid.UUID
+}
+
+// scrapeCollectTimeout is the timeout to collect metrics from DB during a scrape.
+const scrapeCollectTimeout = 10 * time.Second
+
 type Collector struct {
 	Repository      *Repository
 	MetricsRegistry *prometheus.Registry
+
+	// TeamFilter decides teams to be exported.
+	TeamFilter TeamFilter
+
+	// AttachmentQuotaBytes is the total size of attachments each team may upload. 0 disables the quota.
+	AttachmentQuotaBytes int64
+
+	// Interval is the interval to collect metrics periodically.
+	Interval time.Duration
+
+	// If CollectOnScrape is true, Collector collects metrics from DB when Prometheus scrapes it instead of periodically.
+	// Metrics collected within CacheTTL are reused to protect DB from frequent scrapes.
+	CollectOnScrape bool
+	CacheTTL        time.Duration
+
+	// mu serializes collections, as they might be triggered by concurrent scrapes.
+	mu              sync.Mutex
+	lastCollectedAt time.Time
+
+	// lastSuccessfulCollectAt is Unix time in nanoseconds. It's read by health checks without locking mu.
+	lastSuccessfulCollectAt atomic.Int64
+
+	answers *answerIndex
+
+	// observedAnswers is a set of Answer IDs already counted by answersSubmittedTotal.
+	observedAnswers map[uuid.UUID]struct{}
+
+	// observedGradedAnswers is a set of Answer IDs already observed by answerGradingLatencySeconds.
+	observedGradedAnswers map[uuid.UUID]struct{}
 }
 
 func (c *Collector) Run(ctx context.Context) error {
@@ -71,17 +400,23 @@ func (c *Collector) Run(ctx context.Context) error {
 	}
 
 	// Return immediately if error happens in the first collection
-	if err := c.collect(ctx); err != nil {
+	if err := c.collectWithLock(ctx); err != nil {
 		return fmt.Errorf("failed to collect metrics in the first collection: %w", err)
 	}
 
-	collectTicker := time.NewTicker(30 * time.Second)
+	if c.CollectOnScrape {
+		// Metrics will be collected in Collect(), so there is nothing to do here.
+		<-ctx.Done()
+		return nil
+	}
+
+	collectTicker := time.NewTicker(c.Interval)
 	defer collectTicker.Stop()
 
 	for {
 		select {
 		case <-collectTicker.C:
-			if err := c.collect(ctx); err != nil {
+			if err := c.collectWithLock(ctx); err != nil {
 				slog.Error("failed to collect metrics", "error", err)
 			}
 		case <-ctx.Done():
@@ -90,27 +425,132 @@ func (c *Collector) Run(ctx context.Context) error {
 	}
 }
 
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range c.metrics() {
+		metric.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+// It collects metrics from DB before sending them if the last collection is older than CacheTTL.
+// The lock is held until all metrics are sent, as a concurrent scrape might Reset() them during the collection.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastCollectedAt) >= c.CacheTTL {
+		ctx, cancel := context.WithTimeout(context.Background(), scrapeCollectTimeout)
+		if err := c.collect(ctx); err != nil {
+			slog.Error("failed to collect metrics", "error", err)
+		}
+		cancel()
+	}
+
+	for _, metric := range c.metrics() {
+		metric.Collect(ch)
+	}
+}
+
 func (c *Collector) register() error {
-	collectors := []prometheus.Collector{
+	// In CollectOnScrape mode, Collector itself is registered to hook scrapes.
+	if c.CollectOnScrape {
+		return c.MetricsRegistry.Register(c)
+	}
+
+	for _, metric := range c.metrics() {
+		if err := c.MetricsRegistry.Register(metric); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Collector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{
 		metricsCollectDurationSeconds,
+		collectErrorsTotal,
+		lastSuccessfulCollectTimestampSeconds,
+		databaseUp,
 		teamsInfo,
 		problemsInfo,
+		problemPerfectPoint,
+		problemOpened,
+		problemUnlocked,
+		categoriesInfo,
 		teamsTotal,
 		problemsTotal,
 		answersTotal,
 		scores,
+		scorePercents,
+		solvedFlags,
+		penaltiesTotal,
+		penaltyAdjustedScores,
+		teamTotalScore,
+		teamRank,
+		categoryScores,
+		competitionSection,
+		competitionSectionRemainingSeconds,
+		sectionScoreDeltas,
+		problemFirstSolveTimestampSeconds,
+		problemSolvedTeams,
+		issuesTotal,
+		issueOldestUnansweredAgeSeconds,
+		answersSubmittedTotal,
+		answerSubmissionIntervalSeconds,
+		unscoredAnswers,
+		unscoredAnswerOldestAgeSeconds,
+		answerGradingLatencySeconds,
+		noticesTotal,
+		noticeLastPublishedTimestampSeconds,
+		problemSupplementsTotal,
+		problemSupplementLastPublishedTimestampSeconds,
+		attachmentsTotal,
+		attachmentBytes,
+		attachmentQuotaBytes,
+		attachmentQuotaExceeded,
+		problemEnvironments,
+		unassignedProblemEnvironments,
 	}
+}
 
-	for _, collector := range collectors {
-		if err := c.MetricsRegistry.Register(collector); err != nil {
-			return err
-		}
+func (c *Collector) collectWithLock(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.collect(ctx)
+}
+
+// LastSuccessfulCollectAt returns the time when metrics have been collected successfully for the last time.
+func (c *Collector) LastSuccessfulCollectAt() time.Time {
+	return time.Unix(0, c.lastSuccessfulCollectAt.Load())
+}
+
+// collect collects metrics and records the result into the self-health metrics.
+func (c *Collector) collect(ctx context.Context) error {
+	c.lastCollectedAt = time.Now()
+
+	if err := c.Repository.Ping(ctx); err != nil {
+		databaseUp.Set(0)
+		collectErrorsTotal.Inc()
+		return fmt.Errorf("failed to ping database: %w", err)
 	}
+	databaseUp.Set(1)
+
+	if err := c.collectMetrics(ctx); err != nil {
+		collectErrorsTotal.Inc()
+		return err
+	}
+
+	now := time.Now()
+	c.lastSuccessfulCollectAt.Store(now.UnixNano())
+	lastSuccessfulCollectTimestampSeconds.Set(float64(now.Unix()))
 
 	return nil
 }
 
-func (c *Collector) collect(ctx context.Context) error {
+func (c *Collector) collectMetrics(ctx context.Context) error {
 	slog.Info("starting to collect metrics")
 
 	start := time.Now()
@@ -120,19 +560,80 @@ func (c *Collector) collect(ctx context.Context) error {
 		metricsCollectDurationSeconds.Set(duration)
 	}()
 
-	teams, err := c.Repository.FindTeams(ctx)
+	now := time.Now()
+
+	allTeams, err := c.Repository.FindTeams(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to find teams: %w", err)
 	}
+	teams := lo.Filter(allTeams, func(team Team, _ int) bool {
+		return c.TeamFilter.Match(team)
+	})
+	rankedTeams := lo.Filter(allTeams, func(team Team, _ int) bool {
+		return isRankedTeam(team)
+	})
 
 	problems, err := c.Repository.FindProblems(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to find problems: %w", err)
 	}
 
-	allAnswers, err := c.Repository.FindAnswers(ctx)
+	if c.answers == nil {
+		c.answers = newAnswerIndex()
+	}
+	if err := c.answers.update(ctx, c.Repository); err != nil {
+		return fmt.Errorf("failed to update answers: %w", err)
+	}
+	c.pruneObservedAnswers()
+
+	penalties, err := c.Repository.FindPenalties(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find penalties: %w", err)
+	}
+
+	firstCorrectAnswers, err := c.Repository.FindFirstCorrectAnswers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find first correct answers: %w", err)
+	}
+
+	categories, err := c.Repository.FindCategories(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find categories: %w", err)
+	}
+
+	issues, err := c.Repository.FindIssues(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find issues: %w", err)
+	}
+
+	noticeCounts, err := c.Repository.FindNoticeCounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find notice counts: %w", err)
+	}
+
+	problemSupplementCounts, err := c.Repository.FindProblemSupplementCounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find problem supplement counts: %w", err)
+	}
+
+	attachmentUsages, err := c.Repository.FindAttachmentUsages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find attachment usages: %w", err)
+	}
+
+	problemEnvironmentCounts, err := c.Repository.FindProblemEnvironmentCounts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find problem environment counts: %w", err)
+	}
+
+	configs, err := c.Repository.FindConfigs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to find configs: %w", err)
+	}
+
+	contestConfig, err := newContestConfigFrom(configs)
 	if err != nil {
-		return fmt.Errorf("failed to find answers: %w", err)
+		return fmt.Errorf("failed to parse configs: %w", err)
 	}
 
 	// DB might be reset during the collection. So, call Reset() before setting metrics.
@@ -143,8 +644,17 @@ func (c *Collector) collect(ctx context.Context) error {
 
 	// DB might be reset during the collection. So, call Reset() before setting metrics.
 	problemsInfo.Reset()
+	problemPerfectPoint.Reset()
 	for _, problem := range problems {
-		problemsInfo.WithLabelValues(problem.ID.String(), problem.Code, problem.Title).Set(1)
+		categoryID := ""
+		if problem.CategoryID != nil {
+			categoryID = problem.CategoryID.String()
+		}
+		problemsInfo.WithLabelValues(
+			problem.ID.String(), problem.Code, problem.Title, categoryID,
+			problem.Genre, problemModes[problem.Mode], problem.Writer, strconv.FormatBool(problem.Resettable),
+		).Set(1)
+		problemPerfectPoint.WithLabelValues(problem.ID.String()).Set(float64(problem.PerfectPoint))
 	}
 
 	teamsTotal.Set(float64(len(teams)))
@@ -153,42 +663,473 @@ func (c *Collector) collect(ctx context.Context) error {
 	// DB might be reset during the collection. So, call Reset() before setting metrics.
 	answersTotal.Reset()
 	scores.Reset()
-	for _, team := range teams {
+	scorePercents.Reset()
+	solvedFlags.Reset()
+	penaltiesTotal.Reset()
+	penaltyAdjustedScores.Reset()
+	teamTotalScore.Reset()
+	teamRank.Reset()
+
+	penaltyCounts := lo.CountValuesBy(penalties, func(penalty Penalty) teamProblemKey {
+		return teamProblemKey{TeamID: penalty.TeamID, ProblemID: penalty.ProblemID}
+	})
+
+	// teamScores is scores of each team and problem, used to aggregate them in other ways.
+	teamScores := map[teamProblemKey]int{}
+
+	exportedTeams := lo.KeyBy(teams, func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	// Ranked teams not exported are scored too, so that ranks of exported teams match the scoreboard.
+	scoredTeams := lo.UniqBy(slices.Concat(teams, rankedTeams), func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	records := []teamRecord{}
+	for _, team := range scoredTeams {
+		_, exported := exportedTeams[team.ID]
+		record := teamRecord{Team: team}
 		for _, problem := range problems {
-			teamAnswers := lo.Filter(allAnswers, func(answer Answer, _ int) bool {
-				return answer.TeamID == team.ID && answer.ProblemID == problem.ID
-			})
-			bestAnswer := c.findBestAnswerFor(teamAnswers)
-			score := 0
-			if bestAnswer != nil {
-				score = *bestAnswer.Point
+			teamAnswers := c.answers.answersFor(team.ID, problem.ID)
+			effectiveAnswer := c.findEffectiveAnswerFor(teamAnswers, contestConfig, now)
+			score, percent, isSolved := 0, 0, false
+			if effectiveAnswer != nil {
+				score = *effectiveAnswer.Point
+				percent = lo.FromPtr(effectiveAnswer.Percent)
+				isSolved = lo.FromPtr(effectiveAnswer.Solved)
+				if percent >= 100 {
+					record.PerfectCount++
+				}
 			}
+			key := teamProblemKey{TeamID: team.ID, ProblemID: problem.ID}
+			penaltyCount := penaltyCounts[key]
+			record.Score += score + penaltyCount*contestConfig.PenaltyWeight
+
+			if !exported {
+				continue
+			}
+			teamScores[key] = score
 			answersTotal.WithLabelValues(team.ID.String(), problem.ID.String()).Set(float64(len(teamAnswers)))
 			scores.WithLabelValues(team.ID.String(), problem.ID.String()).Set(float64(score))
+			scorePercents.WithLabelValues(team.ID.String(), problem.ID.String()).Set(float64(percent))
+			solvedFlags.WithLabelValues(team.ID.String(), problem.ID.String()).Set(boolToFloat64(isSolved))
+			penaltiesTotal.WithLabelValues(team.ID.String(), problem.ID.String()).Set(float64(penaltyCount))
+			penaltyAdjustedScores.WithLabelValues(team.ID.String(), problem.ID.String()).Set(float64(score + penaltyCount*contestConfig.PenaltyWeight))
 		}
+		records = append(records, record)
 	}
 
+	rankedRecords := lo.Filter(records, func(record teamRecord, _ int) bool {
+		return isRankedTeam(record.Team)
+	})
+	assignRanks(rankedRecords)
+	for _, record := range records {
+		if _, exported := exportedTeams[record.Team.ID]; exported {
+			teamTotalScore.WithLabelValues(record.Team.ID.String()).Set(float64(record.Score))
+		}
+	}
+	for _, record := range rankedRecords {
+		if _, exported := exportedTeams[record.Team.ID]; exported {
+			teamRank.WithLabelValues(record.Team.ID.String()).Set(float64(record.Rank))
+		}
+	}
+
+	c.setCategoryMetrics(teams, problems, categories, teamScores)
+	c.setSectionMetrics(teams, problems, penalties, contestConfig, now)
+	c.setFirstSolveMetrics(teams, problems, firstCorrectAnswers, contestConfig, now)
+	c.setProblemOpenMetrics(teams, problems, firstCorrectAnswers, contestConfig, now)
+	c.setIssueMetrics(teams, problems, issues, now)
+	c.setSubmissionMetrics(teams)
+	c.setGradingMetrics(teams, problems, c.answers.all(), now)
+	c.setAnnouncementMetrics(problems, noticeCounts, problemSupplementCounts)
+	c.setAttachmentMetrics(teams, attachmentUsages)
+	c.setProblemEnvironmentMetrics(problemEnvironmentCounts)
+
 	return nil
 }
 
-// findBestAnswers finds the best answers. The Points in the returned slice are guaranteed to be non-nil.
-func (c *Collector) findBestAnswerFor(answers []Answer) *Answer {
-	var bestAnswer Answer
+func (c *Collector) setCategoryMetrics(teams []Team, problems []Problem, categories []Category, teamScores map[teamProblemKey]int) {
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	categoriesInfo.Reset()
+	categoryScores.Reset()
+	for _, category := range categories {
+		categoriesInfo.WithLabelValues(category.ID.String(), category.Code, category.Title, strconv.Itoa(category.Order)).Set(1)
+
+		categoryProblems := lo.Filter(problems, func(problem Problem, _ int) bool {
+			return problem.CategoryID != nil && *problem.CategoryID == category.ID
+		})
+		for _, team := range teams {
+			score := 0
+			for _, problem := range categoryProblems {
+				score += teamScores[teamProblemKey{TeamID: team.ID, ProblemID: problem.ID}]
+			}
+			categoryScores.WithLabelValues(team.ID.String(), category.ID.String()).Set(float64(score))
+		}
+	}
+}
+
+func (c *Collector) setSectionMetrics(teams []Team, problems []Problem, penalties []Penalty, config *ContestConfig, now time.Time) {
+	current := config.currentCompetitionSection(now)
+	competitionSection.Set(float64(current))
+	if current == 0 {
+		competitionSectionRemainingSeconds.Set(0)
+	} else {
+		competitionSectionRemainingSeconds.Set(config.CompetitionSections[current-1].EndAt.Sub(now).Seconds())
+	}
+
+	penaltiesByTeam := lo.GroupBy(penalties, func(penalty Penalty) uuid.UUID {
+		return penalty.TeamID
+	})
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	sectionScoreDeltas.Reset()
+	for _, team := range teams {
+		for i, section := range config.CompetitionSections {
+			delta := 0
+			if section.StartAt.Before(now) {
+				endAt := section.EndAt
+				if now.Before(endAt) {
+					endAt = now
+				}
+				delta = c.teamScoreAt(team, problems, penaltiesByTeam[team.ID], config, now, endAt) -
+					c.teamScoreAt(team, problems, penaltiesByTeam[team.ID], config, now, section.StartAt)
+			}
+			sectionScoreDeltas.WithLabelValues(team.ID.String(), strconv.Itoa(i+1)).Set(float64(delta))
+		}
+	}
+}
+
+// teamScoreAt calculates the total score of the team, counting only answers and penalties created until at.
+// The answers are graded as they are now, so answers graded after at are counted too.
+func (c *Collector) teamScoreAt(team Team, problems []Problem, teamPenalties []Penalty, config *ContestConfig, now, at time.Time) int {
+	score := 0
+	for _, problem := range problems {
+		answers := lo.Filter(c.answers.answersFor(team.ID, problem.ID), func(answer Answer, _ int) bool {
+			return !answer.CreatedAt.After(at)
+		})
+		if effectiveAnswer := c.findEffectiveAnswerFor(answers, config, now); effectiveAnswer != nil {
+			score += *effectiveAnswer.Point
+		}
+	}
+
+	penaltyCount := lo.CountBy(teamPenalties, func(penalty Penalty) bool {
+		return !penalty.CreatedAt.After(at)
+	})
+	return score + penaltyCount*config.PenaltyWeight
+}
+
+func (c *Collector) setFirstSolveMetrics(teams []Team, problems []Problem, firstCorrectAnswers []FirstCorrectAnswer, config *ContestConfig, now time.Time) {
+	teamsByID := lo.KeyBy(teams, func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	// As FirstCorrectAnswer.delay_filter does, answers within grading_delay_sec are not visible yet.
+	firstCorrectAnswers = lo.Filter(firstCorrectAnswers, func(fca FirstCorrectAnswer, _ int) bool {
+		_, ok := teamsByID[fca.TeamID]
+		return ok && !fca.AnsweredAt.After(now.Add(-config.GradingDelay()))
+	})
+	firstCorrectAnswersByProblem := lo.GroupBy(firstCorrectAnswers, func(fca FirstCorrectAnswer) uuid.UUID {
+		return fca.ProblemID
+	})
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	problemFirstSolveTimestampSeconds.Reset()
+	problemSolvedTeams.Reset()
+	for _, problem := range problems {
+		problemFCAs := firstCorrectAnswersByProblem[problem.ID]
+		problemSolvedTeams.WithLabelValues(problem.ID.String()).Set(float64(len(problemFCAs)))
+
+		if len(problemFCAs) == 0 {
+			continue
+		}
+
+		firstSolve := lo.MinBy(problemFCAs, func(a, b FirstCorrectAnswer) bool {
+			return a.AnsweredAt.Before(b.AnsweredAt)
+		})
+		problemFirstSolveTimestampSeconds.
+			WithLabelValues(problem.ID.String(), firstSolve.TeamID.String()).
+			Set(float64(firstSolve.AnsweredAt.Unix()))
+	}
+}
+
+// findEffectiveAnswerFor finds the answer which counts for the scoreboard in the same way as ScoreAggregator of the score server.
+// The Point in the returned Answer is guaranteed to be non-nil.
+func (c *Collector) findEffectiveAnswerFor(answers []Answer, config *ContestConfig, now time.Time) *Answer {
+	var effectiveAnswer Answer
 	for _, answer := range answers {
 		// Skip answers that are not graded yet
 		if answer.Point == nil {
 			continue
 		}
 
-		// In realtime_grading mode, the best answer is the one with the highest point.
-		// Points in the both Answer should not be nil thanks to the previous check. We can check them safely.
-		if bestAnswer.ID == uuid.Nil || *answer.Point > *bestAnswer.Point {
-			bestAnswer = answer
+		// In realtime_grading mode, players can't see answers submitted within grading_delay_sec.
+		// Skip them as Answer.delay_filter does.
+		if config.RealtimeGrading && answer.CreatedAt.After(now.Add(-config.GradingDelay())) {
+			continue
+		}
+
+		if effectiveAnswer.ID == uuid.Nil || c.hasHigherPriority(answer, effectiveAnswer, config) {
+			effectiveAnswer = answer
+		}
+	}
+
+	if effectiveAnswer.ID == uuid.Nil {
+		return nil
+	}
+	return &effectiveAnswer
+}
+
+// hasHigherPriority reports whether newAnswer should be preferred to currentAnswer.
+// Points in the both Answer must not be nil.
+func (c *Collector) hasHigherPriority(newAnswer, currentAnswer Answer, config *ContestConfig) bool {
+	if config.RealtimeGrading {
+		// In realtime_grading mode, the answer with the highest point is preferred.
+		return *newAnswer.Point > *currentAnswer.Point
+	}
+
+	// Otherwise, the latest answer is preferred.
+	return newAnswer.CreatedAt.After(currentAnswer.CreatedAt)
+}
+
+// setProblemOpenMetrics sets metrics in the same way as Problem.opened of the score server.
+func (c *Collector) setProblemOpenMetrics(teams []Team, problems []Problem, firstCorrectAnswers []FirstCorrectAnswer, config *ContestConfig, now time.Time) {
+	forceOpened := !config.AllProblemForceOpenAt.After(now)
+
+	// Problems solved by any team, including teams not exported, as FirstCorrectAnswer.delay_filter does.
+	solvedByAnyTeam := map[uuid.UUID]struct{}{}
+	solved := map[teamProblemKey]struct{}{}
+	for _, fca := range firstCorrectAnswers {
+		if fca.AnsweredAt.After(now.Add(-config.GradingDelay())) {
+			continue
+		}
+		solvedByAnyTeam[fca.ProblemID] = struct{}{}
+		solved[teamProblemKey{TeamID: fca.TeamID, ProblemID: fca.ProblemID}] = struct{}{}
+	}
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	problemOpened.Reset()
+	problemUnlocked.Reset()
+	for _, problem := range problems {
+		problemOpened.WithLabelValues(problem.ID.String()).Set(boolToFloat64(forceOpened || problem.Opened))
+
+		for _, team := range teams {
+			unlocked := forceOpened || problem.PreviousProblemID == nil
+			if !unlocked {
+				_, solvedByTeam := solved[teamProblemKey{TeamID: team.ID, ProblemID: *problem.PreviousProblemID}]
+				_, solvedByOthers := solvedByAnyTeam[*problem.PreviousProblemID]
+				unlocked = solvedByTeam || (solvedByOthers && !problem.TeamIsolate)
+			}
+			problemUnlocked.WithLabelValues(team.ID.String(), problem.ID.String()).Set(boolToFloat64(unlocked))
 		}
 	}
+}
 
-	if bestAnswer.ID == uuid.Nil {
+// issueUnansweredSince returns when the Issue started waiting for staff, or nil if it's solved or answered.
+// An Issue without comments is waiting since it's created.
+func issueUnansweredSince(issue Issue) *time.Time {
+	switch {
+	case issue.Status == issueStatusSolved:
+		return nil
+	case issue.FirstUnansweredCommentedAt != nil:
+		return issue.FirstUnansweredCommentedAt
+	case issue.LastStaffCommentedAt != nil:
 		return nil
+	default:
+		return &issue.CreatedAt
+	}
+}
+
+func (c *Collector) setIssueMetrics(teams []Team, problems []Problem, issues []Issue, now time.Time) {
+	teamsByID := lo.KeyBy(teams, func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	issues = lo.Filter(issues, func(issue Issue, _ int) bool {
+		_, ok := teamsByID[issue.TeamID]
+		return ok
+	})
+	issuesByProblem := lo.GroupBy(issues, func(issue Issue) uuid.UUID {
+		return issue.ProblemID
+	})
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	issuesTotal.Reset()
+	issueOldestUnansweredAgeSeconds.Reset()
+	for _, problem := range problems {
+		problemIssues := issuesByProblem[problem.ID]
+
+		for status, statusName := range issueStatuses {
+			count := lo.CountBy(problemIssues, func(issue Issue) bool {
+				return issue.Status == status
+			})
+			issuesTotal.WithLabelValues(problem.ID.String(), statusName).Set(float64(count))
+		}
+
+		oldestAge := 0.0
+		for _, issue := range problemIssues {
+			if waitingSince := issueUnansweredSince(issue); waitingSince != nil {
+				oldestAge = max(oldestAge, now.Sub(*waitingSince).Seconds())
+			}
+		}
+		issueOldestUnansweredAgeSeconds.WithLabelValues(problem.ID.String()).Set(oldestAge)
+	}
+}
+
+// pruneObservedAnswers forgets Answers no longer in the index, e.g. after DB reset,
+// so that the sets of observed Answers don't grow forever.
+func (c *Collector) pruneObservedAnswers() {
+	for _, observed := range []map[uuid.UUID]struct{}{c.observedAnswers, c.observedGradedAnswers} {
+		for id := range observed {
+			if !c.answers.has(id) {
+				delete(observed, id)
+			}
+		}
+	}
+}
+
+func (c *Collector) setSubmissionMetrics(teams []Team) {
+	if c.observedAnswers == nil {
+		c.observedAnswers = map[uuid.UUID]struct{}{}
+	}
+
+	teamsByID := lo.KeyBy(teams, func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	// These metrics are a counter and a histogram, so they're not reset here.
+	for _, answer := range c.answers.all() {
+		if _, ok := teamsByID[answer.TeamID]; !ok {
+			continue
+		}
+		if _, ok := c.observedAnswers[answer.ID]; ok {
+			continue
+		}
+		c.observedAnswers[answer.ID] = struct{}{}
+		answersSubmittedTotal.WithLabelValues(answer.ProblemID.String()).Inc()
+
+		var previousAnswer *Answer
+		for _, a := range c.answers.answersFor(answer.TeamID, answer.ProblemID) {
+			if a.CreatedAt.Before(answer.CreatedAt) && (previousAnswer == nil || a.CreatedAt.After(previousAnswer.CreatedAt)) {
+				previousAnswer = &a
+			}
+		}
+		if previousAnswer != nil {
+			answerSubmissionIntervalSeconds.
+				WithLabelValues(answer.ProblemID.String()).
+				Observe(answer.CreatedAt.Sub(previousAnswer.CreatedAt).Seconds())
+		}
+	}
+}
+
+func (c *Collector) setGradingMetrics(teams []Team, problems []Problem, answers []Answer, now time.Time) {
+	if c.observedGradedAnswers == nil {
+		c.observedGradedAnswers = map[uuid.UUID]struct{}{}
+	}
+
+	teamsByID := lo.KeyBy(teams, func(team Team) uuid.UUID {
+		return team.ID
+	})
+
+	answers = lo.Filter(answers, func(answer Answer, _ int) bool {
+		_, ok := teamsByID[answer.TeamID]
+		return ok
+	})
+	answersByProblem := lo.GroupBy(answers, func(answer Answer) uuid.UUID {
+		return answer.ProblemID
+	})
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	// answerGradingLatencySeconds is a histogram, so it's not reset here.
+	unscoredAnswers.Reset()
+	unscoredAnswerOldestAgeSeconds.Reset()
+	for _, problem := range problems {
+		count := 0
+		oldestAge := 0.0
+		for _, answer := range answersByProblem[problem.ID] {
+			if answer.Point == nil {
+				count++
+				oldestAge = max(oldestAge, now.Sub(answer.CreatedAt).Seconds())
+				continue
+			}
+
+			if _, ok := c.observedGradedAnswers[answer.ID]; ok || answer.ScoredAt == nil {
+				continue
+			}
+			c.observedGradedAnswers[answer.ID] = struct{}{}
+			answerGradingLatencySeconds.
+				WithLabelValues(problem.ID.String()).
+				Observe(answer.ScoredAt.Sub(answer.CreatedAt).Seconds())
+		}
+		unscoredAnswers.WithLabelValues(problem.ID.String()).Set(float64(count))
+		unscoredAnswerOldestAgeSeconds.WithLabelValues(problem.ID.String()).Set(oldestAge)
+	}
+}
+
+func (c *Collector) setAnnouncementMetrics(problems []Problem, noticeCounts []NoticeCount, problemSupplementCounts []ProblemSupplementCount) {
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	noticesTotal.Reset()
+	noticeLastPublishedTimestampSeconds.Reset()
+	for _, pinned := range []bool{false, true} {
+		for _, targeted := range []bool{false, true} {
+			noticesTotal.WithLabelValues(strconv.FormatBool(pinned), strconv.FormatBool(targeted)).Set(0)
+		}
+	}
+	for _, count := range noticeCounts {
+		pinned, targeted := strconv.FormatBool(count.Pinned), strconv.FormatBool(count.Targeted)
+		noticesTotal.WithLabelValues(pinned, targeted).Set(float64(count.Count))
+		noticeLastPublishedTimestampSeconds.WithLabelValues(pinned, targeted).Set(float64(count.LastPublishedAt.Unix()))
+	}
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	problemSupplementsTotal.Reset()
+	problemSupplementLastPublishedTimestampSeconds.Reset()
+	for _, problem := range problems {
+		problemSupplementsTotal.WithLabelValues(problem.ID.String()).Set(0)
+	}
+	for _, count := range problemSupplementCounts {
+		problemSupplementsTotal.WithLabelValues(count.ProblemID.String()).Set(float64(count.Count))
+		problemSupplementLastPublishedTimestampSeconds.WithLabelValues(count.ProblemID.String()).Set(float64(count.LastPublishedAt.Unix()))
+	}
+}
+
+func (c *Collector) setAttachmentMetrics(teams []Team, usages []AttachmentUsage) {
+	usagesByTeam := lo.KeyBy(usages, func(usage AttachmentUsage) uuid.UUID {
+		return usage.TeamID
+	})
+
+	attachmentQuotaBytes.Set(float64(c.AttachmentQuotaBytes))
+
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	attachmentsTotal.Reset()
+	attachmentBytes.Reset()
+	attachmentQuotaExceeded.Reset()
+	for _, team := range teams {
+		usage := usagesByTeam[team.ID]
+		exceeded := c.AttachmentQuotaBytes > 0 && usage.Bytes > c.AttachmentQuotaBytes
+
+		attachmentsTotal.WithLabelValues(team.ID.String()).Set(float64(usage.Count))
+		attachmentBytes.WithLabelValues(team.ID.String()).Set(float64(usage.Bytes))
+		attachmentQuotaExceeded.WithLabelValues(team.ID.String()).Set(boolToFloat64(exceeded))
+	}
+}
+
+func (c *Collector) setProblemEnvironmentMetrics(counts []ProblemEnvironmentCount) {
+	// DB might be reset during the collection. So, call Reset() before setting metrics.
+	problemEnvironments.Reset()
+	unassignedProblemEnvironments.Reset()
+	for _, count := range counts {
+		status := lo.FromPtr(count.Status)
+		problemEnvironments.WithLabelValues(count.ProblemID.String(), count.Service, status).Set(float64(count.Count))
+
+		// Services are summed up, so use Add() instead of Set().
+		unassignedProblemEnvironments.WithLabelValues(count.ProblemID.String(), status).Add(float64(count.UnassignedCount))
+	}
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
 	}
-	return &bestAnswer
+	return 0
 }
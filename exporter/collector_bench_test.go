@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+)
+
+const (
+	benchTeamCount    = 100
+	benchProblemCount = 50
+	benchAnswerCount  = 20000
+)
+
+// newBenchAnswers generates Answers spread over teams and problems, all graded and out of the grading delay.
+func newBenchAnswers(now time.Time) ([]Team, []Problem, []Answer) {
+	teams := make([]Team, benchTeamCount)
+	for i := range teams {
+		teams[i] = Team{ID: uuid.New()}
+	}
+	problems := make([]Problem, benchProblemCount)
+	for i := range problems {
+		problems[i] = Problem{ID: uuid.New()}
+	}
+
+	answers := make([]Answer, benchAnswerCount)
+	for i := range answers {
+		point := i % 100
+		createdAt := now.Add(-time.Duration(benchAnswerCount-i) * time.Second)
+		answers[i] = Answer{
+			ID:        uuid.New(),
+			TeamID:    teams[i%benchTeamCount].ID,
+			ProblemID: problems[(i/benchTeamCount)%benchProblemCount].ID,
+			Point:     &point,
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+	}
+	return teams, problems, answers
+}
+
+var benchEffectiveAnswerCount int
+
+// BenchmarkFindEffectiveAnswers_Filter is the team x problem loop before answerIndex, filtering all Answers each time.
+func BenchmarkFindEffectiveAnswers_Filter(b *testing.B) {
+	now := time.Now()
+	teams, problems, answers := newBenchAnswers(now)
+	c := &Collector{}
+	config := &ContestConfig{}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		count := 0
+		for _, team := range teams {
+			for _, problem := range problems {
+				teamAnswers := lo.Filter(answers, func(answer Answer, _ int) bool {
+					return answer.TeamID == team.ID && answer.ProblemID == problem.ID
+				})
+				if c.findEffectiveAnswerFor(teamAnswers, config, now) != nil {
+					count++
+				}
+			}
+		}
+		benchEffectiveAnswerCount = count
+	}
+}
+
+// BenchmarkFindEffectiveAnswers_Index is the same loop looking up Answers with answerIndex.
+func BenchmarkFindEffectiveAnswers_Index(b *testing.B) {
+	now := time.Now()
+	teams, problems, answers := newBenchAnswers(now)
+	c := &Collector{}
+	config := &ContestConfig{}
+
+	index := newAnswerIndex()
+	for _, answer := range answers {
+		index.upsert(answer)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		count := 0
+		for _, team := range teams {
+			for _, problem := range problems {
+				teamAnswers := index.answersFor(team.ID, problem.ID)
+				if c.findEffectiveAnswerFor(teamAnswers, config, now) != nil {
+					count++
+				}
+			}
+		}
+		benchEffectiveAnswerCount = count
+	}
+}
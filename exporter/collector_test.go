@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPruneObservedAnswers(t *testing.T) {
+	kept := Answer{ID: uuid.New()}
+	deleted := Answer{ID: uuid.New()}
+
+	c := &Collector{
+		answers:               newAnswerIndex(),
+		observedAnswers:       map[uuid.UUID]struct{}{kept.ID: {}, deleted.ID: {}},
+		observedGradedAnswers: map[uuid.UUID]struct{}{deleted.ID: {}},
+	}
+	c.answers.upsert(kept)
+
+	c.pruneObservedAnswers()
+
+	if _, ok := c.observedAnswers[kept.ID]; !ok || len(c.observedAnswers) != 1 {
+		t.Errorf("observedAnswers = %v, want only %s", c.observedAnswers, kept.ID)
+	}
+	if len(c.observedGradedAnswers) != 0 {
+		t.Errorf("observedGradedAnswers = %v, want empty", c.observedGradedAnswers)
+	}
+}
+
+func TestIssueUnansweredSince(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := createdAt.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+
+	tests := []struct {
+		name  string
+		issue Issue
+		want  *time.Time
+	}{
+		{
+			name:  "no comments",
+			issue: Issue{CreatedAt: createdAt},
+			want:  &createdAt,
+		},
+		{
+			name:  "only comments from the team",
+			issue: Issue{CreatedAt: createdAt, FirstUnansweredCommentedAt: at(1)},
+			want:  at(1),
+		},
+		{
+			name:  "last comment from staff",
+			issue: Issue{CreatedAt: createdAt, LastStaffCommentedAt: at(5)},
+			want:  nil,
+		},
+		{
+			name:  "comments from the team after staff",
+			issue: Issue{CreatedAt: createdAt, LastStaffCommentedAt: at(5), FirstUnansweredCommentedAt: at(10)},
+			want:  at(10),
+		},
+		{
+			name:  "solved",
+			issue: Issue{CreatedAt: createdAt, Status: issueStatusSolved, FirstUnansweredCommentedAt: at(10)},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueUnansweredSince(tt.issue)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || !got.Equal(*tt.want):
+				t.Errorf("issueUnansweredSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ContestConfig is a set of values in the configs table which the exporter depends on.
+// Every key is required, as Config.get! in the score server raises if the key is missing.
+type ContestConfig struct {
+	PenaltyWeight   int
+	RealtimeGrading bool
+	GradingDelaySec int
+
+	AllProblemForceOpenAt time.Time
+
+	// CompetitionSections are the periods of the contest, like the morning and the afternoon of each day.
+	CompetitionSections [competitionSectionCount]CompetitionSection
+}
+
+const competitionSectionCount = 4
+
+type CompetitionSection struct {
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// currentCompetitionSection returns the 1-origin number of the section in progress, or 0 if no section is in progress.
+func (c *ContestConfig) currentCompetitionSection(now time.Time) int {
+	for i, section := range c.CompetitionSections {
+		// Like Time#between? in Ruby, both ends are inclusive.
+		if !now.Before(section.StartAt) && !now.After(section.EndAt) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func newContestConfigFrom(configs []Config) (*ContestConfig, error) {
+	values := map[string]string{}
+	for _, config := range configs {
+		values[config.Key] = config.Vaule
+	}
+
+	contestConfig := ContestConfig{}
+
+	// The values are stored as JSON, so json.Unmarshal is enough to parse them into Go types.
+	fields := map[string]any{
+		"penalty_weight":    &contestConfig.PenaltyWeight,
+		"realtime_grading":  &contestConfig.RealtimeGrading,
+		"grading_delay_sec": &contestConfig.GradingDelaySec,
+
+		"all_problem_force_open_at": &contestConfig.AllProblemForceOpenAt,
+	}
+	for i := range contestConfig.CompetitionSections {
+		section := &contestConfig.CompetitionSections[i]
+		fields[fmt.Sprintf("competition_section%d_start_at", i+1)] = &section.StartAt
+		fields[fmt.Sprintf("competition_section%d_end_at", i+1)] = &section.EndAt
+	}
+
+	for key, field := range fields {
+		value, ok := values[key]
+		if !ok {
+			return nil, fmt.Errorf("config %q is not found", key)
+		}
+		if err := json.Unmarshal([]byte(value), field); err != nil {
+			return nil, fmt.Errorf("failed to parse config %q: %w", key, err)
+		}
+	}
+
+	return &contestConfig, nil
+}
+
+// GradingDelay returns grading_delay_sec as time.Duration.
+func (c *ContestConfig) GradingDelay() time.Duration {
+	return time.Duration(c.GradingDelaySec) * time.Second
+}
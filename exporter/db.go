@@ -2,13 +2,11 @@ package main
 
 import (
 	"context"
+	"time"
 
 	"github.com/uptrace/bun"
 )
 
-// ignoredTeams is a list of teams that should be ignored by exporter.
-var ignoredTeams = []string{"staff", "team99", "guest"}
-
 type Repository struct {
 	db *bun.DB
 }
@@ -17,13 +15,16 @@ func NewRepository(db *bun.DB) *Repository {
 	return &Repository{db: db}
 }
 
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
 // Answer
 
 func (r *Repository) FindTeams(ctx context.Context) ([]Team, error) {
 	var teams []Team
 	err := r.db.NewSelect().
 		Model(&teams).
-		Where("name NOT IN (?)", bun.In(ignoredTeams)).
 		Scan(ctx)
 	if err != nil {
 		return nil, err
@@ -34,7 +35,10 @@ func (r *Repository) FindTeams(ctx context.Context) ([]Team, error) {
 func (r *Repository) FindProblems(ctx context.Context) ([]Problem, error) {
 	var problems []Problem
 	err := r.db.NewSelect().
-		Column("problems.id", "problems.code", "problem_bodies.title").
+		Column("problems.id", "problems.code", "problems.writer", "problems.category_id", "problems.team_isolate", "problems.previous_problem_id").
+		// open_at is tsrange in UTC, so compare it with the current time in UTC as Problem.filter_by_open_at does.
+		ColumnExpr("(problems.open_at IS NULL OR problems.open_at @> (now() AT TIME ZONE 'UTC')) AS opened").
+		Column("problem_bodies.title", "problem_bodies.genre", "problem_bodies.mode", "problem_bodies.perfect_point", "problem_bodies.resettable").
 		Table("problems").
 		Join("LEFT JOIN problem_bodies").JoinOn("problems.id = problem_bodies.problem_id").
 		Scan(ctx, &problems)
@@ -44,15 +48,191 @@ func (r *Repository) FindProblems(ctx context.Context) ([]Problem, error) {
 	return problems, nil
 }
 
+func (r *Repository) FindCategories(ctx context.Context) ([]Category, error) {
+	var categories []Category
+	err := r.db.NewSelect().
+		Model(&categories).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
 func (r *Repository) FindAnswers(ctx context.Context) ([]Answer, error) {
 	answers := []Answer{}
-	err := r.db.NewSelect().
-		Column("answers.id", "problem_id", "team_id", "scores.point", "answers.created_at").
-		Table("answers").
-		Join("LEFT JOIN scores").JoinOn("answers.id = scores.answer_id").
+	err := r.selectAnswers().Scan(ctx, &answers)
+	if err != nil {
+		return nil, err
+	}
+	return answers, nil
+}
+
+// FindAnswersUpdatedSince finds Answers which has been updated, or whose Score has been updated, after since.
+func (r *Repository) FindAnswersUpdatedSince(ctx context.Context, since time.Time) ([]Answer, error) {
+	answers := []Answer{}
+	err := r.selectAnswers().
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("answers.updated_at > ?", since).
+				WhereOr("scores.updated_at > ?", since)
+		}).
 		Scan(ctx, &answers)
 	if err != nil {
 		return nil, err
 	}
 	return answers, nil
 }
+
+// FindAnswersFingerprint computes the fingerprint of all Answers in the same way as answerIDChecksum.
+func (r *Repository) FindAnswersFingerprint(ctx context.Context) (*AnswersFingerprint, error) {
+	var fingerprint AnswersFingerprint
+	err := r.db.NewSelect().
+		ColumnExpr("COUNT(*) AS count").
+		// SUM of int is bigint, which never overflows with the number of Answers in a contest.
+		ColumnExpr("COALESCE(SUM(('x' || substr(md5(id::text), 1, 8))::bit(32)::int), 0) AS id_checksum").
+		Table("answers").
+		Scan(ctx, &fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return &fingerprint, nil
+}
+
+func (r *Repository) selectAnswers() *bun.SelectQuery {
+	return r.db.NewSelect().
+		Column("answers.id", "problem_id", "team_id", "scores.point", "scores.percent", "scores.solved", "answers.created_at").
+		ColumnExpr("scores.created_at AS scored_at").
+		ColumnExpr("GREATEST(answers.updated_at, scores.updated_at) AS updated_at").
+		Table("answers").
+		Join("LEFT JOIN scores").JoinOn("answers.id = scores.answer_id")
+}
+
+func (r *Repository) FindPenalties(ctx context.Context) ([]Penalty, error) {
+	penalties := []Penalty{}
+	err := r.db.NewSelect().
+		Column("id", "problem_id", "team_id", "created_at").
+		Table("penalties").
+		Scan(ctx, &penalties)
+	if err != nil {
+		return nil, err
+	}
+	return penalties, nil
+}
+
+func (r *Repository) FindFirstCorrectAnswers(ctx context.Context) ([]FirstCorrectAnswer, error) {
+	firstCorrectAnswers := []FirstCorrectAnswer{}
+	err := r.db.NewSelect().
+		Column("first_correct_answers.problem_id", "first_correct_answers.team_id").
+		ColumnExpr("answers.created_at AS answered_at").
+		Table("first_correct_answers").
+		Join("JOIN answers").JoinOn("first_correct_answers.answer_id = answers.id").
+		Scan(ctx, &firstCorrectAnswers)
+	if err != nil {
+		return nil, err
+	}
+	return firstCorrectAnswers, nil
+}
+
+func (r *Repository) FindIssues(ctx context.Context) ([]Issue, error) {
+	lastStaffComment := r.db.NewSelect().
+		ColumnExpr("MAX(created_at) AS created_at").
+		Table("issue_comments").
+		Where("issue_comments.issue_id = issues.id").
+		Where("issue_comments.from_staff")
+
+	// Players reopen the same Issue by commenting again, so the first comment not answered yet is used
+	// instead of the last one, not to restart the clock on every reminder.
+	firstUnansweredComment := r.db.NewSelect().
+		ColumnExpr("MIN(created_at) AS created_at").
+		Table("issue_comments").
+		Where("issue_comments.issue_id = issues.id").
+		Where("NOT issue_comments.from_staff").
+		Where("last_staff_comment.created_at IS NULL OR issue_comments.created_at > last_staff_comment.created_at")
+
+	issues := []Issue{}
+	err := r.db.NewSelect().
+		Column("issues.id", "issues.problem_id", "issues.team_id", "issues.status", "issues.created_at").
+		ColumnExpr("last_staff_comment.created_at AS last_staff_commented_at").
+		ColumnExpr("first_unanswered_comment.created_at AS first_unanswered_commented_at").
+		Table("issues").
+		Join("LEFT JOIN LATERAL (?) AS last_staff_comment ON TRUE", lastStaffComment).
+		Join("LEFT JOIN LATERAL (?) AS first_unanswered_comment ON TRUE", firstUnansweredComment).
+		Scan(ctx, &issues)
+	if err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func (r *Repository) FindProblemEnvironmentCounts(ctx context.Context) ([]ProblemEnvironmentCount, error) {
+	counts := []ProblemEnvironmentCount{}
+	err := r.db.NewSelect().
+		Column("problem_id", "service", "status").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("COUNT(*) FILTER (WHERE team_id IS NULL) AS unassigned_count").
+		Table("problem_environments").
+		Group("problem_id", "service", "status").
+		Scan(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (r *Repository) FindNoticeCounts(ctx context.Context) ([]NoticeCount, error) {
+	counts := []NoticeCount{}
+	err := r.db.NewSelect().
+		Column("pinned").
+		ColumnExpr("team_id IS NOT NULL AS targeted").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("MAX(created_at) AS last_published_at").
+		Table("notices").
+		GroupExpr("pinned, targeted").
+		Scan(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (r *Repository) FindProblemSupplementCounts(ctx context.Context) ([]ProblemSupplementCount, error) {
+	counts := []ProblemSupplementCount{}
+	err := r.db.NewSelect().
+		Column("problem_id").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("MAX(created_at) AS last_published_at").
+		Table("problem_supplements").
+		Group("problem_id").
+		Scan(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (r *Repository) FindAttachmentUsages(ctx context.Context) ([]AttachmentUsage, error) {
+	usages := []AttachmentUsage{}
+	err := r.db.NewSelect().
+		Column("team_id").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("SUM(size) AS bytes").
+		Table("attachments").
+		Group("team_id").
+		Scan(ctx, &usages)
+	if err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
+
+func (r *Repository) FindConfigs(ctx context.Context) ([]Config, error) {
+	var configs []Config
+	err := r.db.NewSelect().
+		Model(&configs).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthzHandler responds OK only if metrics have been collected successfully within maxStaleness.
+// Otherwise, dashboards would keep showing the last values as if they were fresh.
+func healthzHandler(collector *Collector, maxStaleness time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		staleness := time.Since(collector.LastSuccessfulCollectAt())
+		if staleness > maxStaleness {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "metrics are stale: last successful collection was %s ago\n", staleness.Truncate(time.Second))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -20,12 +23,22 @@ import (
 type Command struct {
 	cobra.Command
 
+	configFile             string
 	listenAddr             string
+	postgresDSN            string
 	postgresHost           string
 	postgresUser           string
 	postgresPassword       string
+	postgresPasswordFile   string
 	postgresDatabase       string
 	postgresDisableSSLMode bool
+	collectInterval        time.Duration
+	collectOnScrape        bool
+	collectCacheTTL        time.Duration
+	healthzMaxStaleness    time.Duration
+	includeTeams           []string
+	excludeTeams           []string
+	attachmentQuotaBytes   int64
 }
 
 func (c *Command) ExecuteContext(ctx context.Context) error {
@@ -37,32 +50,90 @@ func NewCommand() Command {
 
 	cmd.Command = cobra.Command{
 		Use:  "netcon-score-server-exporter",
+		Long: optionsHelp,
 		RunE: cmd.RunE,
 	}
 
+	cmd.Flags().StringVar(&cmd.configFile, configFlagName, "", "Path to the YAML config file")
 	cmd.Flags().StringVar(&cmd.listenAddr, "listen-addr", ":3000", "Listen Address for metrics server")
+	cmd.Flags().StringVar(&cmd.postgresDSN, "postgres-dsn", "", "PostgreSQL DSN (overrides the other PostgreSQL options)")
 	cmd.Flags().StringVar(&cmd.postgresHost, "postgres-host", "localhost:5432", "PostgreSQL host")
 	cmd.Flags().StringVar(&cmd.postgresUser, "postgres-user", "postgres", "PostgreSQL user")
 	cmd.Flags().StringVar(&cmd.postgresPassword, "postgres-password", "postgres", "PostgreSQL password")
+	cmd.Flags().StringVar(&cmd.postgresPasswordFile, "postgres-password-file", "", "Path to the file containing PostgreSQL password (overrides --postgres-password)")
 	cmd.Flags().StringVar(&cmd.postgresDatabase, "postgres-database", "development", "PostgreSQL password")
 	cmd.Flags().BoolVar(&cmd.postgresDisableSSLMode, "postgres-disable-ssl-mode", false, "Disable SSL to PostgreSQL")
+	cmd.Flags().DurationVar(&cmd.collectInterval, "collect-interval", 30*time.Second, "Interval to collect metrics from PostgreSQL")
+	cmd.Flags().BoolVar(&cmd.collectOnScrape, "collect-on-scrape", false, "Collect metrics from PostgreSQL on each scrape instead of periodically")
+	cmd.Flags().DurationVar(&cmd.collectCacheTTL, "collect-cache-ttl", 10*time.Second, "Duration to reuse collected metrics in --collect-on-scrape mode")
+	cmd.Flags().StringSliceVar(&cmd.includeTeams, "include-teams", nil, "Name patterns of non-player teams to be exported (e.g. audience*)")
+	cmd.Flags().StringSliceVar(&cmd.excludeTeams, "exclude-teams", []string{"staff", "guest"}, "Name patterns of teams not to be exported in addition to team99")
+	cmd.Flags().Int64Var(&cmd.attachmentQuotaBytes, "attachment-quota-bytes", 0, "Total size of attachments each team may upload (0 disables the quota)")
+	cmd.Flags().DurationVar(&cmd.healthzMaxStaleness, "healthz-max-staleness", 2*time.Minute, "/healthz fails if metrics haven't been collected successfully for this duration")
 
 	return cmd
 }
 
-func (c *Command) buildDSN() string {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s", c.postgresUser, c.postgresPassword, c.postgresHost, c.postgresDatabase)
+func (c *Command) buildDSN() (string, error) {
+	if c.postgresDSN != "" {
+		return c.postgresDSN, nil
+	}
+
+	password := c.postgresPassword
+	if c.postgresPasswordFile != "" {
+		var err error
+		if password, err = readPasswordFile(c.postgresPasswordFile); err != nil {
+			return "", err
+		}
+	}
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.postgresUser, password),
+		Host:   c.postgresHost,
+		Path:   c.postgresDatabase,
+	}
 	if c.postgresDisableSSLMode {
-		dsn += "?sslmode=disable"
+		dsn.RawQuery = "sslmode=disable"
 	}
-	return dsn
+	return dsn.String(), nil
 }
 
 func (c *Command) RunE(cmd *cobra.Command, _ []string) error {
+	if err := loadOptions(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if c.collectInterval <= 0 {
+		return fmt.Errorf("--collect-interval must be positive: %s", c.collectInterval)
+	}
+	if c.collectCacheTTL < 0 {
+		return fmt.Errorf("--collect-cache-ttl must not be negative: %s", c.collectCacheTTL)
+	}
+	// /healthz would fail between successful collections if it allowed less staleness than they are apart.
+	if c.collectOnScrape {
+		if c.healthzMaxStaleness <= c.collectCacheTTL {
+			return fmt.Errorf("--healthz-max-staleness must be longer than --collect-cache-ttl: %s <= %s", c.healthzMaxStaleness, c.collectCacheTTL)
+		}
+	} else if c.healthzMaxStaleness <= c.collectInterval {
+		return fmt.Errorf("--healthz-max-staleness must be longer than --collect-interval: %s <= %s", c.healthzMaxStaleness, c.collectInterval)
+	}
+
+	teamFilter := TeamFilter{
+		IncludePatterns: c.includeTeams,
+		ExcludePatterns: c.excludeTeams,
+	}
+	if err := teamFilter.Validate(); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancelCause(cmd.Context())
 	defer cancel(nil)
 
-	dsn := c.buildDSN()
+	dsn, err := c.buildDSN()
+	if err != nil {
+		return err
+	}
 	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
 	db := bun.NewDB(sqldb, pgdialect.New())
 
@@ -71,13 +142,23 @@ func (c *Command) RunE(cmd *cobra.Command, _ []string) error {
 	registry := prometheus.NewRegistry()
 
 	metricsCollector := Collector{
-		Repository:      repository,
-		MetricsRegistry: registry,
+		Repository:           repository,
+		MetricsRegistry:      registry,
+		TeamFilter:           teamFilter,
+		AttachmentQuotaBytes: c.attachmentQuotaBytes,
+		Interval:             c.collectInterval,
+		CollectOnScrape:      c.collectOnScrape,
+		CacheTTL:             c.collectCacheTTL,
 	}
 
+	mux := http.NewServeMux()
+	// Metrics have been served on any path, so keep it for backward compatibility.
+	mux.Handle("/", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", healthzHandler(&metricsCollector, c.healthzMaxStaleness))
+
 	metricsServer := Server{
 		ListenAddr: c.listenAddr,
-		Handler:    promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		Handler:    mux,
 	}
 
 	go func() {
@@ -12,13 +12,52 @@ type Answer struct {
 	ProblemID uuid.UUID `bun:"problem_id"`
 	TeamID    uuid.UUID `bun:"team_id"`
 	Point     *int      `bun:"point"`
+	Percent   *int      `bun:"percent"`
+	Solved    *bool     `bun:"solved"`
 	CreatedAt time.Time `bun:"created_at"`
+
+	// ScoredAt is created_at of the Score. It's nil if the Answer has no Score.
+	ScoredAt *time.Time `bun:"scored_at"`
+
+	// UpdatedAt is the latest updated_at of the Answer and its Score.
+	UpdatedAt time.Time `bun:"updated_at"`
+}
+
+// AnswersFingerprint summarizes the set of Answer IDs, to detect Answers deleted or replaced without updates.
+// IDChecksum is the sum of answerIDChecksum of all IDs, so that it doesn't depend on the order of rows.
+type AnswersFingerprint struct {
+	Count      int   `bun:"count"`
+	IDChecksum int64 `bun:"id_checksum"`
 }
 
 type Problem struct {
+	ID          uuid.UUID  `bun:"id"`
+	Code        string     `bun:"code"`
+	Writer      string     `bun:"writer"`
+	CategoryID  *uuid.UUID `bun:"category_id"`
+	TeamIsolate bool       `bun:"team_isolate"`
+
+	// PreviousProblemID is the problem which must be solved before this problem is unlocked.
+	PreviousProblemID *uuid.UUID `bun:"previous_problem_id"`
+
+	// Opened reports whether the current time is within open_at. It's true if open_at is NULL.
+	Opened bool `bun:"opened"`
+
+	// The following fields are derived from ProblemBody
+	Title        string `bun:"title"`
+	Genre        string `bun:"genre"`
+	Mode         int    `bun:"mode"`
+	PerfectPoint int    `bun:"perfect_point"`
+	Resettable   bool   `bun:"resettable"`
+}
+
+type Category struct {
+	bun.BaseModel `bun:"table:categories"`
+
 	ID    uuid.UUID `bun:"id"`
 	Code  string    `bun:"code"`
 	Title string    `bun:"title"`
+	Order int       `bun:"order"`
 }
 
 type Score struct {
@@ -29,12 +68,79 @@ type Score struct {
 	Solved bool      `bun:"solved"`
 }
 
+// FirstCorrectAnswer is a row of first_correct_answers joined with answers.
+type FirstCorrectAnswer struct {
+	ProblemID uuid.UUID `bun:"problem_id"`
+	TeamID    uuid.UUID `bun:"team_id"`
+
+	// AnsweredAt is created_at of the Answer, not of the FirstCorrectAnswer itself.
+	AnsweredAt time.Time `bun:"answered_at"`
+}
+
+// Issue is a row of issues joined with the times of its issue_comments.
+type Issue struct {
+	ID        uuid.UUID `bun:"id"`
+	ProblemID uuid.UUID `bun:"problem_id"`
+	TeamID    uuid.UUID `bun:"team_id"`
+	Status    int       `bun:"status"`
+	CreatedAt time.Time `bun:"created_at"`
+
+	// LastStaffCommentedAt is nil if staff has never commented.
+	LastStaffCommentedAt *time.Time `bun:"last_staff_commented_at"`
+
+	// FirstUnansweredCommentedAt is the first comment from the team after LastStaffCommentedAt.
+	// It's nil if there is no such comment.
+	FirstUnansweredCommentedAt *time.Time `bun:"first_unanswered_commented_at"`
+}
+
+// ProblemEnvironmentCount is the number of problem_environments grouped by problem, service and status.
+type ProblemEnvironmentCount struct {
+	ProblemID uuid.UUID `bun:"problem_id"`
+	Service   string    `bun:"service"`
+	Status    *string   `bun:"status"`
+	Count     int       `bun:"count"`
+
+	// UnassignedCount is the number of problem_environments which has no team_id.
+	UnassignedCount int `bun:"unassigned_count"`
+}
+
+// NoticeCount is the number of notices grouped by pinned and whether they target a specific team.
+type NoticeCount struct {
+	Pinned          bool      `bun:"pinned"`
+	Targeted        bool      `bun:"targeted"`
+	Count           int       `bun:"count"`
+	LastPublishedAt time.Time `bun:"last_published_at"`
+}
+
+// ProblemSupplementCount is the number of problem_supplements for each problem.
+type ProblemSupplementCount struct {
+	ProblemID       uuid.UUID `bun:"problem_id"`
+	Count           int       `bun:"count"`
+	LastPublishedAt time.Time `bun:"last_published_at"`
+}
+
+// AttachmentUsage is the number and the total size of attachments uploaded by each team.
+type AttachmentUsage struct {
+	TeamID uuid.UUID `bun:"team_id"`
+	Count  int       `bun:"count"`
+	Bytes  int64     `bun:"bytes"`
+}
+
+type Penalty struct {
+	ID        uuid.UUID `bun:"id"`
+	ProblemID uuid.UUID `bun:"problem_id"`
+	TeamID    uuid.UUID `bun:"team_id"`
+	CreatedAt time.Time `bun:"created_at"`
+}
+
 type Team struct {
 	bun.BaseModel `bun:"table:teams"`
 
 	ID           uuid.UUID `bun:"id"`
+	Role         int       `bun:"role"`
 	Name         string    `bun:"name"`
 	Organization string    `bun:"organization"`
+	Beginner     bool      `bun:"beginner"`
 }
 
 type Config struct {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of environment variables to set flags.
+const envPrefix = "NETCON_"
+
+// configFlagName is the name of the flag to give the config file.
+const configFlagName = "config"
+
+// optionsHelp describes how options are given. It's shown in the help message.
+const optionsHelp = `Options are taken from the following sources, in order of precedence:
+
+  1. Command line flags (e.g. --postgres-host=db:5432)
+  2. Environment variables prefixed with NETCON_ (e.g. NETCON_POSTGRES_HOST=db:5432)
+  3. The YAML config file given by --config or NETCON_CONFIG (e.g. postgres-host: db:5432)
+  4. Default values
+
+To keep secrets out of the process arguments, give them with environment variables, the config file
+or --postgres-password-file instead of --postgres-password and --postgres-dsn.`
+
+// loadOptions sets flags not given on the command line from environment variables and the config file.
+// The precedence order is described in optionsHelp.
+func loadOptions(flags *pflag.FlagSet) error {
+	configFile := flags.Lookup(configFlagName).Value.String()
+	if value, ok := os.LookupEnv(envNameOf(configFlagName)); ok && !flags.Changed(configFlagName) {
+		configFile = value
+	}
+
+	fileValues := map[string]any{}
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	for name := range fileValues {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in config file", name)
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+
+		if value, ok := os.LookupEnv(envNameOf(flag.Name)); ok {
+			if setErr := flags.Set(flag.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value for %s: %w", envNameOf(flag.Name), setErr)
+			}
+			return
+		}
+
+		if value, ok := fileValues[flag.Name]; ok {
+			if setErr := flags.Set(flag.Name, stringifyOption(value)); setErr != nil {
+				err = fmt.Errorf("invalid value for %q in config file: %w", flag.Name, setErr)
+			}
+		}
+	})
+
+	return err
+}
+
+// envNameOf converts a flag name into the name of the environment variable, e.g. postgres-host to NETCON_POSTGRES_HOST.
+func envNameOf(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// stringifyOption converts a value in the config file into the form accepted by pflag.
+// Lists are joined with commas as slice flags accept comma-separated values.
+func stringifyOption(value any) string {
+	if values, ok := value.([]any); ok {
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			strs = append(strs, fmt.Sprint(v))
+		}
+		return strings.Join(strs, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// readPasswordFile reads a password from the file, ignoring the trailing newline.
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
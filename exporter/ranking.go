@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+)
+
+// teamRecord is a row of the scoreboard.
+type teamRecord struct {
+	Team         Team
+	Score        int
+	PerfectCount int
+	Rank         int
+}
+
+// assignRanks ranks records in the same way as ScoreAggregator of the score server.
+// Beginner teams and the others are ranked independently, and tied teams share the rank like 1, 2, 2, 4.
+func assignRanks(records []teamRecord) {
+	groups := map[bool][]*teamRecord{}
+	for i := range records {
+		record := &records[i]
+		groups[record.Team.Beginner] = append(groups[record.Team.Beginner], record)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].Score != group[j].Score {
+				return group[i].Score > group[j].Score
+			}
+			return group[i].PerfectCount > group[j].PerfectCount
+		})
+
+		for i, record := range group {
+			if i > 0 && group[i-1].Score == record.Score && group[i-1].PerfectCount == record.PerfectCount {
+				record.Rank = group[i-1].Rank
+			} else {
+				record.Rank = i + 1
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAssignRanks(t *testing.T) {
+	// record builds a teamRecord whose team name is used to identify it in the results.
+	record := func(name string, beginner bool, score, perfectCount int) teamRecord {
+		return teamRecord{Team: Team{Name: name, Beginner: beginner}, Score: score, PerfectCount: perfectCount}
+	}
+
+	tests := []struct {
+		name    string
+		records []teamRecord
+		want    map[string]int
+	}{
+		{
+			name:    "no records",
+			records: []teamRecord{},
+			want:    map[string]int{},
+		},
+		{
+			name: "tied teams share the rank like 1, 2, 2, 4",
+			records: []teamRecord{
+				record("c", false, 50, 0),
+				record("a", false, 100, 0),
+				record("d", false, 10, 0),
+				record("b", false, 50, 0),
+			},
+			want: map[string]int{"a": 1, "b": 2, "c": 2, "d": 4},
+		},
+		{
+			name: "perfect_count breaks ties on equal score",
+			records: []teamRecord{
+				record("a", false, 100, 1),
+				record("b", false, 100, 2),
+				record("c", false, 100, 1),
+			},
+			want: map[string]int{"b": 1, "a": 2, "c": 2},
+		},
+		{
+			name: "beginner teams and the others are ranked independently",
+			records: []teamRecord{
+				record("a", false, 100, 0),
+				record("b", true, 50, 0),
+				record("c", false, 80, 0),
+				record("d", true, 70, 0),
+			},
+			want: map[string]int{"a": 1, "c": 2, "d": 1, "b": 2},
+		},
+		{
+			name: "only beginner teams",
+			records: []teamRecord{
+				record("a", true, 10, 0),
+				record("b", true, 20, 0),
+			},
+			want: map[string]int{"b": 1, "a": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assignRanks(tt.records)
+
+			got := map[string]int{}
+			for _, record := range tt.records {
+				got[record.Team.Name] = record.Rank
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ranks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// teamRolePlayer is the value of Team.role for players in the score server.
+const teamRolePlayer = 1
+
+// teamNameTeam99 is the name of the special team used in every contest. It's not ranked on the scoreboard.
+const teamNameTeam99 = "team99"
+
+// isRankedTeam reports whether the team is ranked on the scoreboard, as Team.player_without_team99 of the score server.
+// Ranks don't depend on TeamFilter, so that they always match the scoreboard.
+func isRankedTeam(team Team) bool {
+	return team.Role == teamRolePlayer && team.Name != teamNameTeam99
+}
+
+// TeamFilter decides which teams are exported.
+// Players are exported by default. Teams matching IncludePatterns are exported even if they are not players,
+// and teams matching ExcludePatterns are never exported. Patterns are matched against team names by path.Match.
+// team99 is never exported regardless of the patterns, because it's only for testing.
+type TeamFilter struct {
+	IncludePatterns []string
+	ExcludePatterns []string
+}
+
+func (f *TeamFilter) Validate() error {
+	for _, pattern := range slices.Concat(f.IncludePatterns, f.ExcludePatterns) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid team name pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (f *TeamFilter) Match(team Team) bool {
+	if team.Name == teamNameTeam99 || matchAny(f.ExcludePatterns, team.Name) {
+		return false
+	}
+	return team.Role == teamRolePlayer || matchAny(f.IncludePatterns, team.Name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated beforehand, so the error can be ignored.
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
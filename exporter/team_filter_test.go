@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestTeamFilterValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  TeamFilter
+		wantErr bool
+	}{
+		{
+			name:   "no patterns",
+			filter: TeamFilter{},
+		},
+		{
+			name:   "valid patterns",
+			filter: TeamFilter{IncludePatterns: []string{"audience*"}, ExcludePatterns: []string{"staff", "test[0-9]"}},
+		},
+		{
+			name:    "invalid include pattern",
+			filter:  TeamFilter{IncludePatterns: []string{"audience["}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid exclude pattern",
+			filter:  TeamFilter{ExcludePatterns: []string{"staff", "test["}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTeamFilterMatch(t *testing.T) {
+	const teamRoleStaff = 10
+
+	filter := TeamFilter{
+		IncludePatterns: []string{"audience*", "guest"},
+		ExcludePatterns: []string{"staff", "guest", "team0*"},
+	}
+
+	tests := []struct {
+		name string
+		team Team
+		want bool
+	}{
+		{
+			name: "player",
+			team: Team{Name: "team10", Role: teamRolePlayer},
+			want: true,
+		},
+		{
+			name: "non-player",
+			team: Team{Name: "operator", Role: teamRoleStaff},
+			want: false,
+		},
+		{
+			name: "non-player matching include",
+			team: Team{Name: "audience1", Role: teamRoleStaff},
+			want: true,
+		},
+		{
+			name: "player matching exclude",
+			team: Team{Name: "team01", Role: teamRolePlayer},
+			want: false,
+		},
+		{
+			name: "exclude takes precedence over include",
+			team: Team{Name: "guest", Role: teamRoleStaff},
+			want: false,
+		},
+		{
+			name: "team99 is always excluded",
+			team: Team{Name: teamNameTeam99, Role: teamRolePlayer},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Match(tt.team); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.team.Name, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("team99 is excluded without patterns", func(t *testing.T) {
+		filter := TeamFilter{}
+		if filter.Match(Team{Name: teamNameTeam99, Role: teamRolePlayer}) {
+			t.Errorf("Match(%q) = true, want false", teamNameTeam99)
+		}
+	})
+}
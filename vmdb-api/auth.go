@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// requireAPIToken is a middleware to allow only requests with "Authorization: Bearer <token>".
+// If token is empty, all requests are rejected, so that the write API is disabled unless the token is configured.
+func requireAPIToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if token == "" {
+				slog.WarnContext(ctx, "write API is disabled as API token is not configured")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				slog.WarnContext(ctx, "invalid API token")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{
+			name:          "valid token",
+			token:         "secret",
+			authorization: "Bearer secret",
+			want:          http.StatusOK,
+		},
+		{
+			name:          "token not configured",
+			token:         "",
+			authorization: "Bearer ",
+			want:          http.StatusForbidden,
+		},
+		{
+			name:          "missing token",
+			token:         "secret",
+			authorization: "",
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			token:         "secret",
+			authorization: "Bearer wrong",
+			want:          http.StatusUnauthorized,
+		},
+		{
+			name:          "not bearer",
+			token:         "secret",
+			authorization: "Basic secret",
+			want:          http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := requireAPIToken(tt.token)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/problem-environments", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status code = %d, want %d", recorder.Code, tt.want)
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("handler called = %v, want %v", called, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -89,33 +95,518 @@ func newProblemEnvironmentResponseFrom(problemEnvironment ProblemEnvironment, la
 	}
 }
 
+// nextCursorHeader is the response header to tell the cursor of the next page.
+// The cursor is returned as a header to keep the response body compatible with the previous version.
+const nextCursorHeader = "X-Next-Cursor"
+
+// maxProblemEnvironmentsLimit is the max value of the limit query parameter.
+const maxProblemEnvironmentsLimit = 1000
+
+func parseProblemEnvironmentFilter(query url.Values) (*problemEnvironmentFilter, error) {
+	filter := problemEnvironmentFilter{
+		ProblemCode: query.Get("problem_code"),
+		TeamName:    query.Get("team_name"),
+		Status:      query.Get("status"),
+		Service:     query.Get("service"),
+		Host:        query.Get("host"),
+	}
+
+	if teamIDStr := query.Get("team_id"); teamIDStr != "" {
+		teamID, err := uuid.Parse(teamIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid team_id: %w", err)
+		}
+		filter.TeamID = &teamID
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := uuid.Parse(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		filter.After = &after
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxProblemEnvironmentsLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d: %q", maxProblemEnvironmentsLimit, limitStr)
+		}
+		filter.Limit = limit
+	}
+
+	return &filter, nil
+}
+
+// newProblemEnvironmentResponsesFrom finds the latest Answers for all ProblemEnvironments in a single query.
+func (c *Controller) newProblemEnvironmentResponsesFrom(ctx context.Context, problemEnvironments []ProblemEnvironment) (listProblemEnvironmentsResponse, error) {
+	keys := []problemTeamKey{}
+	for _, pe := range problemEnvironments {
+		keys = append(keys, problemTeamKey{ProblemID: pe.ProblemID, TeamID: pe.TeamID})
+	}
+
+	latestAnswers, err := c.repo.listLatestAnswersFor(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	response := listProblemEnvironmentsResponse{}
+	for _, pe := range problemEnvironments {
+		var latestAnswer *Answer
+		if answer, ok := latestAnswers[problemTeamKey{ProblemID: pe.ProblemID, TeamID: pe.TeamID}]; ok {
+			latestAnswer = &answer
+		}
+
+		response = append(response, newProblemEnvironmentResponseFrom(pe, latestAnswer))
+	}
+	return response, nil
+}
+
 func (c *Controller) listProblemEnvironments(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	problemEnvironments, err := c.repo.listProblemEnvironments(ctx)
+	filter, err := parseProblemEnvironmentFilter(r.URL.Query())
+	if err != nil {
+		slog.WarnContext(ctx, "invalid query parameters", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	problemEnvironments, err := c.repo.listProblemEnvironments(ctx, *filter)
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to list ProblemEnvironments", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	response := listProblemEnvironmentsResponse{}
-	for _, pe := range problemEnvironments {
-		latestAnswer, err := c.repo.findLatestAnswerFor(ctx, pe.ProblemID, pe.TeamID)
-		if err != nil {
-			slog.ErrorContext(ctx, "failed to find latest Answer", "error", err)
+	response, err := c.newProblemEnvironmentResponsesFrom(ctx, problemEnvironments)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list latest Answers", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// If the page is full, there might be more ProblemEnvironments.
+	if filter.Limit > 0 && len(problemEnvironments) == filter.Limit {
+		w.Header().Set(nextCursorHeader, problemEnvironments[len(problemEnvironments)-1].ID.String())
+	}
+
+	if err := renderJSON(w, http.StatusOK, response); err != nil {
+		slog.ErrorContext(ctx, "failed to render JSON", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+type problemEnvironmentRequest struct {
+	InnerStatus *string    `json:"inner_status"`
+	Host        string     `json:"host"`
+	User        string     `json:"user"`
+	Password    string     `json:"password"`
+	ProblemID   uuid.UUID  `json:"problem_id"`
+	TeamID      *uuid.UUID `json:"team_id"`
+	SecretText  string     `json:"secret_text"`
+	Name        string     `json:"name"`
+	Service     string     `json:"service"`
+	Port        uint16     `json:"port"`
+}
+
+func decodeProblemEnvironmentRequest(r *http.Request) (*problemEnvironmentRequest, error) {
+	var request problemEnvironmentRequest
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+
+	// The same validations as ProblemEnvironment in the score server
+	if request.ProblemID == uuid.Nil {
+		return nil, errors.New("problem_id is required")
+	}
+	if request.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if request.Service == "" {
+		return nil, errors.New("service is required")
+	}
+	if request.Port == 0 {
+		return nil, errors.New("port is required")
+	}
+
+	return &request, nil
+}
+
+func (req *problemEnvironmentRequest) applyTo(problemEnvironment *ProblemEnvironment) {
+	problemEnvironment.InnerStatus = req.InnerStatus
+	problemEnvironment.Host = req.Host
+	problemEnvironment.User = req.User
+	problemEnvironment.Password = req.Password
+	problemEnvironment.ProblemID = req.ProblemID
+	problemEnvironment.TeamID = uuid.Nil
+	if req.TeamID != nil {
+		problemEnvironment.TeamID = *req.TeamID
+	}
+	problemEnvironment.SecretText = req.SecretText
+	problemEnvironment.Name = req.Name
+	problemEnvironment.Service = req.Service
+	problemEnvironment.Port = req.Port
+}
+
+func (c *Controller) createProblemEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	request, err := decodeProblemEnvironmentRequest(r)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Timestamps are stored in UTC without time zone by the score server
+	now := time.Now().UTC()
+	problemEnvironment := ProblemEnvironment{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	request.applyTo(&problemEnvironment)
+
+	if !c.validateProblemEnvironment(w, r, &problemEnvironment) {
+		return
+	}
+
+	if err := c.repo.createProblemEnvironment(ctx, &problemEnvironment); err != nil {
+		var transitionErr *statusTransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			renderStatusTransitionError(w, r, transitionErr)
+		case isUniqueViolation(err):
+			slog.WarnContext(ctx, "ProblemEnvironment already exists", "error", err)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			slog.ErrorContext(ctx, "failed to create ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.renderProblemEnvironment(w, r, http.StatusCreated, problemEnvironment)
+}
+
+func (c *Controller) updateProblemEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	problemEnvironmentIDStr := chi.URLParam(r, "problemEnvironmentID")
+	problemEnvironmentID, err := uuid.Parse(problemEnvironmentIDStr)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid path parameters", "problem_environment_id", problemEnvironmentIDStr)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	request, err := decodeProblemEnvironmentRequest(r)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	problemEnvironment, err := c.repo.findProblemEnvironmentByID(ctx, problemEnvironmentID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to find ProblemEnvironment", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	request.applyTo(problemEnvironment)
+	problemEnvironment.UpdatedAt = time.Now().UTC()
+
+	if !c.validateProblemEnvironment(w, r, problemEnvironment) {
+		return
+	}
+
+	if err := c.repo.updateProblemEnvironment(ctx, problemEnvironment); err != nil {
+		var transitionErr *statusTransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			renderStatusTransitionError(w, r, transitionErr)
+		case errors.Is(err, sql.ErrNoRows):
+			slog.WarnContext(ctx, "ProblemEnvironment has been deleted", "error", err)
+			w.WriteHeader(http.StatusNotFound)
+		case isUniqueViolation(err):
+			slog.WarnContext(ctx, "ProblemEnvironment already exists", "error", err)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			slog.ErrorContext(ctx, "failed to update ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.renderProblemEnvironment(w, r, http.StatusOK, *problemEnvironment)
+}
+
+type updateProblemEnvironmentStatusRequest struct {
+	Status string `json:"status"`
+}
+
+func (c *Controller) updateProblemEnvironmentStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	problemEnvironmentIDStr := chi.URLParam(r, "problemEnvironmentID")
+	problemEnvironmentID, err := uuid.Parse(problemEnvironmentIDStr)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid path parameters", "problem_environment_id", problemEnvironmentIDStr)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var request updateProblemEnvironmentStatusRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil || request.Status == "" {
+		slog.WarnContext(ctx, "invalid request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	problemEnvironment, err := c.repo.updateProblemEnvironmentStatus(ctx, problemEnvironmentID, request.Status, time.Now().UTC())
+	if err != nil {
+		var transitionErr *statusTransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			renderStatusTransitionError(w, r, transitionErr)
+		case errors.Is(err, sql.ErrNoRows):
+			slog.WarnContext(ctx, "failed to find ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			slog.ErrorContext(ctx, "failed to update status of ProblemEnvironment", "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.renderProblemEnvironment(w, r, http.StatusOK, *problemEnvironment)
+}
+
+type acquireProblemEnvironmentRequest struct {
+	ProblemID uuid.UUID `json:"problem_id"`
+	TeamID    uuid.UUID `json:"team_id"`
+}
+
+func (c *Controller) acquireProblemEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var request acquireProblemEnvironmentRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil || request.ProblemID == uuid.Nil || request.TeamID == uuid.Nil {
+		slog.WarnContext(ctx, "invalid request body", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if _, err := c.repo.findProblemBy(ctx, request.ProblemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to find Problem", "error", err, "problem_id", request.ProblemID)
+			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
 		}
+		slog.ErrorContext(ctx, "failed to find Problem", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		response = append(response, newProblemEnvironmentResponseFrom(pe, latestAnswer))
+	problemEnvironments, err := c.repo.acquireProblemEnvironments(ctx, request.ProblemID, request.TeamID, time.Now().UTC())
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			slog.WarnContext(ctx, "failed to find Team", "error", err, "team_id", request.TeamID)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case errors.Is(err, errProblemEnvironmentAlreadyAssigned):
+			slog.WarnContext(ctx, "failed to acquire ProblemEnvironment", "error", err, "team_id", request.TeamID)
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, errNoProblemEnvironmentAvailable):
+			// The same status code as the gateway returns when no environment is available
+			slog.WarnContext(ctx, "failed to acquire ProblemEnvironment", "error", err, "problem_id", request.ProblemID)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			slog.ErrorContext(ctx, "failed to acquire ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.renderProblemEnvironments(w, r, problemEnvironments)
+}
+
+func (c *Controller) releaseProblemEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	problemEnvironmentIDStr := chi.URLParam(r, "problemEnvironmentID")
+	problemEnvironmentID, err := uuid.Parse(problemEnvironmentIDStr)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid path parameters", "problem_environment_id", problemEnvironmentIDStr)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	problemEnvironments, err := c.repo.releaseProblemEnvironments(ctx, problemEnvironmentID, time.Now().UTC())
+	if err != nil {
+		var transitionErr *statusTransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			renderStatusTransitionError(w, r, transitionErr)
+		case errors.Is(err, sql.ErrNoRows):
+			slog.WarnContext(ctx, "failed to find ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, errProblemEnvironmentNotAssigned):
+			slog.WarnContext(ctx, "failed to release ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			slog.ErrorContext(ctx, "failed to release ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.renderProblemEnvironments(w, r, problemEnvironments)
+}
+
+// statusTransitionErrorResponse tells clients why the status transition is rejected and which statuses are allowed.
+type statusTransitionErrorResponse struct {
+	Error           string   `json:"error"`
+	Message         string   `json:"message"`
+	CurrentStatus   *string  `json:"current_status"`
+	RequestedStatus *string  `json:"requested_status"`
+	AllowedStatuses []string `json:"allowed_statuses"`
+}
+
+func renderStatusTransitionError(w http.ResponseWriter, r *http.Request, err *statusTransitionError) {
+	ctx := r.Context()
+
+	slog.WarnContext(ctx, "invalid status transition", "error", err)
+
+	response := statusTransitionErrorResponse{
+		Error:           "invalid_status_transition",
+		Message:         err.Error(),
+		CurrentStatus:   err.From,
+		AllowedStatuses: err.Allowed,
+	}
+	if err.To != "" {
+		response.RequestedStatus = &err.To
+	}
+
+	if err := renderJSON(w, http.StatusConflict, response); err != nil {
+		slog.ErrorContext(ctx, "failed to render JSON", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (c *Controller) deleteProblemEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	problemEnvironmentIDStr := chi.URLParam(r, "problemEnvironmentID")
+	problemEnvironmentID, err := uuid.Parse(problemEnvironmentIDStr)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid path parameters", "problem_environment_id", problemEnvironmentIDStr)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := c.repo.deleteProblemEnvironment(ctx, problemEnvironmentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to find ProblemEnvironment", "error", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(ctx, "failed to delete ProblemEnvironment", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateProblemEnvironment checks the ProblemEnvironment can be saved, and writes the error response if not.
+func (c *Controller) validateProblemEnvironment(w http.ResponseWriter, r *http.Request, problemEnvironment *ProblemEnvironment) bool {
+	ctx := r.Context()
+
+	if _, err := c.repo.findProblemBy(ctx, problemEnvironment.ProblemID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.WarnContext(ctx, "failed to find Problem", "error", err, "problem_id", problemEnvironment.ProblemID)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return false
+		}
+		slog.ErrorContext(ctx, "failed to find Problem", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	// team_id is optional as unassigned ProblemEnvironments have no team
+	if problemEnvironment.TeamID != uuid.Nil {
+		if _, err := c.repo.findTeamBy(ctx, problemEnvironment.TeamID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				slog.WarnContext(ctx, "failed to find Team", "error", err, "team_id", problemEnvironment.TeamID)
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return false
+			}
+			slog.ErrorContext(ctx, "failed to find Team", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	// The unique index is also checked by DB, but check it beforehand to tell the reason explicitly
+	exists, err := c.repo.existsProblemEnvironmentWith(ctx, problemEnvironment)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check ProblemEnvironment", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if exists {
+		slog.WarnContext(ctx, "ProblemEnvironment with the same problem_id, name and service already exists",
+			"problem_id", problemEnvironment.ProblemID, "name", problemEnvironment.Name, "service", problemEnvironment.Service)
+		w.WriteHeader(http.StatusConflict)
+		return false
+	}
+
+	return true
+}
+
+func (c *Controller) renderProblemEnvironments(w http.ResponseWriter, r *http.Request, problemEnvironments []ProblemEnvironment) {
+	ctx := r.Context()
+
+	response, err := c.newProblemEnvironmentResponsesFrom(ctx, problemEnvironments)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list latest Answers", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	if err := renderJSON(w, http.StatusOK, response); err != nil {
 		slog.ErrorContext(ctx, "failed to render JSON", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (c *Controller) renderProblemEnvironment(w http.ResponseWriter, r *http.Request, statusCode int, problemEnvironment ProblemEnvironment) {
+	ctx := r.Context()
+
+	latestAnswer, err := c.repo.findLatestAnswerFor(ctx, problemEnvironment.ProblemID, problemEnvironment.TeamID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to find latest Answer", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	response := newProblemEnvironmentResponseFrom(problemEnvironment, latestAnswer)
+
+	if err := renderJSON(w, statusCode, response); err != nil {
+		slog.ErrorContext(ctx, "failed to render JSON", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 }
 
 type getAnswerIDResponse struct {
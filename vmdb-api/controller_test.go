@@ -0,0 +1,669 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+// queryCounter counts queries sent to DB.
+type queryCounter struct {
+	count atomic.Int64
+}
+
+func (q *queryCounter) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (q *queryCounter) AfterQuery(_ context.Context, _ *bun.QueryEvent) {
+	q.count.Add(1)
+}
+
+func TestParseProblemEnvironmentFilter(t *testing.T) {
+	teamID := uuid.New()
+	cursor := uuid.New()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    problemEnvironmentFilter
+		wantErr bool
+	}{
+		{
+			name:  "no parameters",
+			query: "",
+			want:  problemEnvironmentFilter{},
+		},
+		{
+			name:  "all parameters",
+			query: "problem_code=ABC&team_id=" + teamID.String() + "&team_name=team01&status=READY&service=SSH&host=192.0.2.1&cursor=" + cursor.String() + "&limit=10",
+			want: problemEnvironmentFilter{
+				ProblemCode: "ABC", TeamID: &teamID, TeamName: "team01", Status: "READY", Service: "SSH", Host: "192.0.2.1", After: &cursor, Limit: 10,
+			},
+		},
+		{
+			name:  "minimum limit",
+			query: "limit=1",
+			want:  problemEnvironmentFilter{Limit: 1},
+		},
+		{
+			name:  "maximum limit",
+			query: fmt.Sprintf("limit=%d", maxProblemEnvironmentsLimit),
+			want:  problemEnvironmentFilter{Limit: maxProblemEnvironmentsLimit},
+		},
+		{
+			name:    "zero limit",
+			query:   "limit=0",
+			wantErr: true,
+		},
+		{
+			name:    "too large limit",
+			query:   fmt.Sprintf("limit=%d", maxProblemEnvironmentsLimit+1),
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric limit",
+			query:   "limit=ten",
+			wantErr: true,
+		},
+		{
+			name:    "invalid team_id",
+			query:   "team_id=team01",
+			wantErr: true,
+		},
+		{
+			name:    "invalid cursor",
+			query:   "cursor=next",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %v", err)
+			}
+
+			got, err := parseProblemEnvironmentFilter(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProblemEnvironmentFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// DeepEqual compares the UUIDs TeamID and After point to.
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseProblemEnvironmentFilter() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	// Invalid parameters are rejected before querying DB, so the controller doesn't need it.
+	for _, query := range []string{"limit=0", "team_id=team01", "cursor=next"} {
+		t.Run("400 for "+query, func(t *testing.T) {
+			controller := Controller{}
+			recorder := httptest.NewRecorder()
+			controller.listProblemEnvironments(recorder, httptest.NewRequest(http.MethodGet, "/problem-environments?"+query, nil))
+			if recorder.Code != http.StatusBadRequest {
+				t.Errorf("status code = %d, want %d", recorder.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestListProblemEnvironmentsWithLatestAnswers(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+	ctx := context.Background()
+
+	team1 := insertTestTeam(t, db, "team01")
+	team2 := insertTestTeam(t, db, "team02")
+	problem1 := insertTestProblem(t, db, "ABC")
+	problem2 := insertTestProblem(t, db, "DEF")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestAnswer(t, db, problem1, team1, "old", now.Add(-2*time.Minute))
+	insertTestAnswer(t, db, problem1, team1, "latest", now.Add(-time.Minute))
+	insertTestAnswer(t, db, problem2, team1, "only", now)
+	// Answers of other pairs must not be mixed up.
+	insertTestAnswer(t, db, problem2, team2, "other", now)
+
+	insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problem1, TeamID: team1, Name: "vm-answered"})
+	insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problem1, TeamID: team2, Name: "vm-no-answers"})
+	insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problem2, TeamID: team1, Name: "vm-single-answer"})
+	insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problem1, Name: "vm-no-team"})
+
+	counter := &queryCounter{}
+	db.AddQueryHook(counter)
+
+	list := func(t *testing.T) (listProblemEnvironmentsResponse, int64) {
+		t.Helper()
+
+		counter.count.Store(0)
+		recorder := httptest.NewRecorder()
+		controller.listProblemEnvironments(recorder, httptest.NewRequest(http.MethodGet, "/problem-environments", nil))
+		queries := counter.count.Load()
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status code = %d, want %d", recorder.Code, http.StatusOK)
+		}
+		var response listProblemEnvironmentsResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return response, queries
+	}
+
+	response, queries := list(t)
+
+	want := map[string]string{
+		"vm-answered":      "latest",
+		"vm-no-answers":    "",
+		"vm-single-answer": "only",
+		"vm-no-team":       "",
+	}
+	if len(response) != len(want) {
+		t.Fatalf("len(response) = %d, want %d", len(response), len(want))
+	}
+	for _, got := range response {
+		if got.LatestAnswerBody != want[got.Name] {
+			t.Errorf("latest_answer_body of %s = %q, want %q", got.Name, got.LatestAnswerBody, want[got.Name])
+		}
+
+		// The result must be the same as finding the latest Answer for each ProblemEnvironment.
+		problemEnvironment, err := repo.findProblemEnvironmentByID(ctx, got.ID)
+		if err != nil {
+			t.Fatalf("failed to find problem environment: %v", err)
+		}
+		latestAnswer, err := repo.findLatestAnswerFor(ctx, problemEnvironment.ProblemID, problemEnvironment.TeamID)
+		if err != nil {
+			t.Fatalf("failed to find latest answer: %v", err)
+		}
+		if expected := newProblemEnvironmentResponseFrom(*problemEnvironment, latestAnswer); got.LatestAnswerBody != expected.LatestAnswerBody {
+			t.Errorf("latest_answer_body of %s = %q, but findLatestAnswerFor gives %q", got.Name, got.LatestAnswerBody, expected.LatestAnswerBody)
+		}
+	}
+
+	// The number of queries must not depend on the number of ProblemEnvironments.
+	for i := 0; i < 20; i++ {
+		insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problem2, TeamID: team2, Name: fmt.Sprintf("vm-extra-%d", i)})
+	}
+	response, queriesForMore := list(t)
+	if len(response) != len(want)+20 {
+		t.Fatalf("len(response) = %d, want %d", len(response), len(want)+20)
+	}
+	if queriesForMore != queries {
+		t.Errorf("queries for %d problem environments = %d, but %d for %d", len(response), queriesForMore, queries, len(want))
+	}
+	if queries != 2 {
+		t.Errorf("queries = %d, want 2", queries)
+	}
+}
+
+func TestListProblemEnvironmentsByPage(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+
+	const total, limit = 7, 3
+
+	problemID := insertTestProblem(t, db, "ABC")
+	for i := range total {
+		insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problemID, Name: fmt.Sprintf("vm%d", i), Port: 22})
+	}
+
+	seen := map[uuid.UUID]struct{}{}
+	var lastID string
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > total {
+			t.Fatalf("paging doesn't end after %d pages", page)
+		}
+
+		query := url.Values{"limit": {fmt.Sprint(limit)}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		recorder := httptest.NewRecorder()
+		controller.listProblemEnvironments(recorder, httptest.NewRequest(http.MethodGet, "/problem-environments?"+query.Encode(), nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status code of page %d = %d, want %d", page, recorder.Code, http.StatusOK)
+		}
+		var response listProblemEnvironmentsResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode page %d: %v", page, err)
+		}
+
+		for _, problemEnvironment := range response {
+			if _, ok := seen[problemEnvironment.ID]; ok {
+				t.Errorf("%s is returned more than once", problemEnvironment.ID)
+			}
+			seen[problemEnvironment.ID] = struct{}{}
+
+			// UUIDs are compared bytewise in PostgreSQL, which is the same order as their strings.
+			if id := problemEnvironment.ID.String(); id <= lastID {
+				t.Errorf("%s is returned after %s", id, lastID)
+			} else {
+				lastID = id
+			}
+		}
+
+		cursor = recorder.Header().Get(nextCursorHeader)
+		if len(response) == limit {
+			if want := response[len(response)-1].ID.String(); cursor != want {
+				t.Errorf("%s of the full page %d = %q, want %q", nextCursorHeader, page, cursor, want)
+			}
+		} else if cursor != "" {
+			t.Errorf("%s of the last page %d = %q, want empty", nextCursorHeader, page, cursor)
+		}
+		if cursor == "" {
+			break
+		}
+	}
+
+	if len(seen) != total {
+		t.Errorf("%d problem environments are returned, want %d", len(seen), total)
+	}
+}
+
+func TestWriteProblemEnvironmentErrors(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+
+	problemID := insertTestProblem(t, db, "ABC")
+	teamID := insertTestTeam(t, db, "team01")
+	existing := insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problemID, Name: "vm0", Service: "SSH", Port: 22})
+	other := insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problemID, Name: "vm1", Service: "SSH", Port: 22})
+
+	router := chi.NewRouter()
+	router.Post("/problem-environments", controller.createProblemEnvironment)
+	router.Put("/problem-environments/{problemEnvironmentID}", controller.updateProblemEnvironment)
+	router.Delete("/problem-environments/{problemEnvironmentID}", controller.deleteProblemEnvironment)
+
+	// body builds a request body for a ProblemEnvironment of the problem.
+	body := func(problemID uuid.UUID, teamID *uuid.UUID, name string) map[string]any {
+		return map[string]any{
+			"host": "192.0.2.1", "user": "user", "password": "password", "secret_text": "",
+			"problem_id": problemID, "team_id": teamID, "name": name, "service": "SSH", "port": 22,
+		}
+	}
+	unknownID := uuid.New()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]any
+		want   int
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/problem-environments",
+			body:   body(problemID, &teamID, "vm2"),
+			want:   http.StatusCreated,
+		},
+		{
+			name:   "create duplicate",
+			method: http.MethodPost,
+			path:   "/problem-environments",
+			body:   body(problemID, nil, existing.Name),
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "update into duplicate",
+			method: http.MethodPut,
+			path:   "/problem-environments/" + other.ID.String(),
+			body:   body(problemID, nil, existing.Name),
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "create with unknown problem",
+			method: http.MethodPost,
+			path:   "/problem-environments",
+			body:   body(unknownID, nil, "vm3"),
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "create with unknown team",
+			method: http.MethodPost,
+			path:   "/problem-environments",
+			body:   body(problemID, &unknownID, "vm3"),
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "update with unknown team",
+			method: http.MethodPut,
+			path:   "/problem-environments/" + other.ID.String(),
+			body:   body(problemID, &unknownID, other.Name),
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "update missing",
+			method: http.MethodPut,
+			path:   "/problem-environments/" + unknownID.String(),
+			body:   body(problemID, nil, "vm3"),
+			want:   http.StatusNotFound,
+		},
+		{
+			name:   "delete missing",
+			method: http.MethodDelete,
+			path:   "/problem-environments/" + unknownID.String(),
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestBody bytes.Buffer
+			if tt.body != nil {
+				if err := json.NewEncoder(&requestBody).Encode(tt.body); err != nil {
+					t.Fatalf("failed to encode request body: %v", err)
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, &requestBody))
+			if recorder.Code != tt.want {
+				t.Errorf("status code = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateProblemEnvironmentStatus(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+	ctx := context.Background()
+
+	problemID := insertTestProblem(t, db, "ABC")
+	ready := statusReady
+	problemEnvironment := insertTestProblemEnvironment(t, db, ProblemEnvironment{ProblemID: problemID, Name: "vm0", InnerStatus: &ready, Port: 22})
+
+	router := chi.NewRouter()
+	router.Patch("/problem-environments/{problemEnvironmentID}/status", controller.updateProblemEnvironmentStatus)
+
+	patch := func(t *testing.T, status string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, _ := json.Marshal(updateProblemEnvironmentStatusRequest{Status: status})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPatch, "/problem-environments/"+problemEnvironment.ID.String()+"/status", bytes.NewReader(body)))
+		return recorder
+	}
+
+	countTransitions := func(t *testing.T) int {
+		t.Helper()
+
+		count, err := db.NewSelect().Model((*ProblemEnvironmentStatusTransition)(nil)).Count(ctx)
+		if err != nil {
+			t.Fatalf("failed to count status transitions: %v", err)
+		}
+		return count
+	}
+
+	// READY can't skip UNDER_CHALLENGE.
+	recorder := patch(t, statusUnderScoring)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("status code = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+	var errorResponse statusTransitionErrorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&errorResponse); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if errorResponse.Error != "invalid_status_transition" {
+		t.Errorf("error = %q, want %q", errorResponse.Error, "invalid_status_transition")
+	}
+	if errorResponse.CurrentStatus == nil || *errorResponse.CurrentStatus != statusReady {
+		t.Errorf("current_status = %v, want %s", errorResponse.CurrentStatus, statusReady)
+	}
+	if want := statusTransitions[statusReady]; !slices.Equal(errorResponse.AllowedStatuses, want) {
+		t.Errorf("allowed_statuses = %v, want %v", errorResponse.AllowedStatuses, want)
+	}
+	if count := countTransitions(t); count != 0 {
+		t.Errorf("status transitions after the rejected update = %d, want 0", count)
+	}
+
+	if recorder := patch(t, statusUnderChallenge); recorder.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	updated, err := repo.findProblemEnvironmentByID(ctx, problemEnvironment.ID)
+	if err != nil {
+		t.Fatalf("failed to find problem environment: %v", err)
+	}
+
+	// Retrying the same status is a no-op.
+	if recorder := patch(t, statusUnderChallenge); recorder.Code != http.StatusOK {
+		t.Fatalf("status code of the retry = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	retried, err := repo.findProblemEnvironmentByID(ctx, problemEnvironment.ID)
+	if err != nil {
+		t.Fatalf("failed to find problem environment: %v", err)
+	}
+	if !retried.UpdatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("updated_at is changed by the retry from %s to %s", updated.UpdatedAt, retried.UpdatedAt)
+	}
+
+	var transitions []ProblemEnvironmentStatusTransition
+	if err := db.NewSelect().Model(&transitions).Scan(ctx); err != nil {
+		t.Fatalf("failed to select status transitions: %v", err)
+	}
+	if len(transitions) != 1 {
+		t.Fatalf("status transitions = %d, want 1", len(transitions))
+	}
+	transition := transitions[0]
+	if transition.ProblemEnvironmentID != problemEnvironment.ID {
+		t.Errorf("problem_environment_id = %s, want %s", transition.ProblemEnvironmentID, problemEnvironment.ID)
+	}
+	if transition.FromStatus == nil || *transition.FromStatus != statusReady || transition.ToStatus != statusUnderChallenge {
+		t.Errorf("transition = %v to %s, want %s to %s", transition.FromStatus, transition.ToStatus, statusReady, statusUnderChallenge)
+	}
+	if !transition.CreatedAt.Equal(updated.UpdatedAt) {
+		t.Errorf("created_at = %s, want updated_at of the problem environment %s", transition.CreatedAt, updated.UpdatedAt)
+	}
+}
+
+// acquireConcurrently sends the acquire requests in parallel, and returns the status codes and the responses.
+func acquireConcurrently(controller *Controller, requests []acquireProblemEnvironmentRequest) ([]int, []listProblemEnvironmentsResponse) {
+	codes := make([]int, len(requests))
+	responses := make([]listProblemEnvironmentsResponse, len(requests))
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			body, _ := json.Marshal(request)
+			<-start
+
+			recorder := httptest.NewRecorder()
+			controller.acquireProblemEnvironment(recorder, httptest.NewRequest(http.MethodPost, "/problem-environments/acquire", bytes.NewReader(body)))
+			codes[i] = recorder.Code
+			if recorder.Code == http.StatusOK {
+				json.NewDecoder(recorder.Body).Decode(&responses[i])
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	return codes, responses
+}
+
+func TestAcquireProblemEnvironmentsConcurrently(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+	ctx := context.Background()
+
+	const vmCount, teamCount = 3, 10
+	services := []string{"HTTP", "SSH"}
+
+	problemID := insertTestProblem(t, db, "ABC")
+	ready := statusReady
+	for i := range vmCount {
+		for _, service := range services {
+			insertTestProblemEnvironment(t, db, ProblemEnvironment{
+				ProblemID: problemID, Name: fmt.Sprintf("vm%d", i), Service: service, InnerStatus: &ready, Port: 22,
+			})
+		}
+	}
+
+	requests := []acquireProblemEnvironmentRequest{}
+	for i := range teamCount {
+		requests = append(requests, acquireProblemEnvironmentRequest{
+			ProblemID: problemID,
+			TeamID:    insertTestTeam(t, db, fmt.Sprintf("team%02d", i+1)),
+		})
+	}
+
+	codes, responses := acquireConcurrently(&controller, requests)
+
+	// ownerOf is the team which each VM is assigned to, according to the responses.
+	ownerOf := map[string]uuid.UUID{}
+	succeeded := 0
+	for i, code := range codes {
+		teamID := requests[i].TeamID
+		switch code {
+		case http.StatusOK:
+			succeeded++
+			if len(responses[i]) != len(services) {
+				t.Errorf("team %s got %d problem environments, want %d", teamID, len(responses[i]), len(services))
+				continue
+			}
+			for _, problemEnvironment := range responses[i] {
+				if problemEnvironment.TeamID != teamID {
+					t.Errorf("team %s got %s assigned to %s", teamID, problemEnvironment.ID, problemEnvironment.TeamID)
+				}
+				if problemEnvironment.Name != responses[i][0].Name {
+					t.Errorf("team %s got services of different VMs: %s and %s", teamID, problemEnvironment.Name, responses[i][0].Name)
+				}
+				if owner, ok := ownerOf[problemEnvironment.Name]; ok && owner != teamID {
+					t.Errorf("%s is assigned to both %s and %s", problemEnvironment.Name, owner, teamID)
+				}
+				ownerOf[problemEnvironment.Name] = teamID
+			}
+		case http.StatusServiceUnavailable, http.StatusConflict:
+		default:
+			t.Errorf("team %s got status code %d", teamID, code)
+		}
+	}
+	if succeeded != vmCount {
+		t.Errorf("%d teams acquired problem environments, want %d", succeeded, vmCount)
+	}
+
+	// Check the committed rows too, as responses might differ from them.
+	var problemEnvironments []ProblemEnvironment
+	if err := db.NewSelect().Model(&problemEnvironments).Scan(ctx); err != nil {
+		t.Fatalf("failed to select problem environments: %v", err)
+	}
+	for _, problemEnvironment := range problemEnvironments {
+		if problemEnvironment.TeamID != ownerOf[problemEnvironment.Name] {
+			t.Errorf("%s (%s) is assigned to %s in DB, but %s in responses",
+				problemEnvironment.Name, problemEnvironment.Service, problemEnvironment.TeamID, ownerOf[problemEnvironment.Name])
+		}
+		if status := *problemEnvironment.InnerStatus; status != statusUnderChallenge {
+			t.Errorf("status of %s (%s) = %s, want %s", problemEnvironment.Name, problemEnvironment.Service, status, statusUnderChallenge)
+		}
+	}
+
+	transitions, err := db.NewSelect().Model((*ProblemEnvironmentStatusTransition)(nil)).Count(ctx)
+	if err != nil {
+		t.Fatalf("failed to count status transitions: %v", err)
+	}
+	if transitions != vmCount*len(services) {
+		t.Errorf("status transitions = %d, want %d", transitions, vmCount*len(services))
+	}
+}
+
+func TestAcquireProblemEnvironmentsConcurrentlyBySameTeam(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+
+	teamID := insertTestTeam(t, db, "team01")
+	ready := statusReady
+	problemIDs := []uuid.UUID{insertTestProblem(t, db, "ABC"), insertTestProblem(t, db, "DEF")}
+	for _, problemID := range problemIDs {
+		for i := range 3 {
+			insertTestProblemEnvironment(t, db, ProblemEnvironment{
+				ProblemID: problemID, Name: fmt.Sprintf("vm%d", i), InnerStatus: &ready, Port: 22,
+			})
+		}
+	}
+
+	requests := []acquireProblemEnvironmentRequest{}
+	for i := range 10 {
+		requests = append(requests, acquireProblemEnvironmentRequest{ProblemID: problemIDs[i%len(problemIDs)], TeamID: teamID})
+	}
+
+	codes, responses := acquireConcurrently(&controller, requests)
+
+	// The team can challenge only one VM, and requests for the other problem conflict.
+	acquired := map[uuid.UUID]struct{}{}
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK:
+			for _, problemEnvironment := range responses[i] {
+				acquired[problemEnvironment.ID] = struct{}{}
+			}
+		case http.StatusConflict:
+		default:
+			t.Errorf("request for %s got status code %d", requests[i].ProblemID, code)
+		}
+	}
+	if len(acquired) != 1 {
+		t.Errorf("the team acquired %d problem environments, want 1", len(acquired))
+	}
+}
+
+func TestReleaseAbandonedProblemEnvironments(t *testing.T) {
+	repo, db := newTestRepository(t)
+	controller := Controller{repo: repo}
+	ctx := context.Background()
+
+	teamID := insertTestTeam(t, db, "team01")
+	problemID := insertTestProblem(t, db, "ABC")
+	abandoned := statusAbandoned
+	ssh := insertTestProblemEnvironment(t, db, ProblemEnvironment{
+		ProblemID: problemID, TeamID: teamID, Name: "vm0", Service: "SSH", InnerStatus: &abandoned, Port: 22,
+	})
+	insertTestProblemEnvironment(t, db, ProblemEnvironment{
+		ProblemID: problemID, TeamID: teamID, Name: "vm0", Service: "HTTP", InnerStatus: &abandoned, Port: 80,
+	})
+
+	router := chi.NewRouter()
+	router.Post("/problem-environments/{problemEnvironmentID}/release", controller.releaseProblemEnvironment)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/problem-environments/"+ssh.ID.String()+"/release", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	// All services of the VM are released together.
+	var problemEnvironments []ProblemEnvironment
+	if err := db.NewSelect().Model(&problemEnvironments).Scan(ctx); err != nil {
+		t.Fatalf("failed to select problem environments: %v", err)
+	}
+	for _, problemEnvironment := range problemEnvironments {
+		if problemEnvironment.TeamID != uuid.Nil {
+			t.Errorf("%s is still assigned to %s", problemEnvironment.Service, problemEnvironment.TeamID)
+		}
+		if status := *problemEnvironment.InnerStatus; status != statusNotReady {
+			t.Errorf("status of %s = %s, want %s", problemEnvironment.Service, status, statusNotReady)
+		}
+	}
+}
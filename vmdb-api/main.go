@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 
@@ -19,12 +19,16 @@ import (
 type Command struct {
 	cobra.Command
 
+	configFile             string
 	listenAddr             string
+	postgresDSN            string
 	postgresHost           string
 	postgresUser           string
 	postgresPassword       string
+	postgresPasswordFile   string
 	postgresDatabase       string
 	postgresDisableSSLMode bool
+	apiToken               string
 }
 
 func (c *Command) ExecuteContext(ctx context.Context) error {
@@ -36,32 +40,61 @@ func NewCommand() Command {
 
 	cmd.Command = cobra.Command{
 		Use:  "netcon-score-server-vmdb-api",
+		Long: optionsHelp,
 		RunE: cmd.RunE,
 	}
 
+	cmd.Flags().StringVar(&cmd.configFile, configFlagName, "", "Path to the YAML config file")
 	cmd.Flags().StringVar(&cmd.listenAddr, "listen-addr", ":8080", "Listen Address for metrics server")
+	cmd.Flags().StringVar(&cmd.postgresDSN, "postgres-dsn", "", "PostgreSQL DSN (overrides the other PostgreSQL options)")
 	cmd.Flags().StringVar(&cmd.postgresHost, "postgres-host", "localhost:5432", "PostgreSQL host")
 	cmd.Flags().StringVar(&cmd.postgresUser, "postgres-user", "postgres", "PostgreSQL user")
 	cmd.Flags().StringVar(&cmd.postgresPassword, "postgres-password", "postgres", "PostgreSQL password")
+	cmd.Flags().StringVar(&cmd.postgresPasswordFile, "postgres-password-file", "", "Path to the file containing PostgreSQL password (overrides --postgres-password)")
 	cmd.Flags().StringVar(&cmd.postgresDatabase, "postgres-database", "development", "PostgreSQL password")
 	cmd.Flags().BoolVar(&cmd.postgresDisableSSLMode, "postgres-disable-ssl-mode", false, "Disable SSL to PostgreSQL")
+	cmd.Flags().StringVar(&cmd.apiToken, "api-token", "", "Bearer token for the write API (the write API is disabled if empty)")
 
 	return cmd
 }
 
-func (c *Command) buildDSN() string {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s", c.postgresUser, c.postgresPassword, c.postgresHost, c.postgresDatabase)
+func (c *Command) buildDSN() (string, error) {
+	if c.postgresDSN != "" {
+		return c.postgresDSN, nil
+	}
+
+	password := c.postgresPassword
+	if c.postgresPasswordFile != "" {
+		var err error
+		if password, err = readPasswordFile(c.postgresPasswordFile); err != nil {
+			return "", err
+		}
+	}
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.postgresUser, password),
+		Host:   c.postgresHost,
+		Path:   c.postgresDatabase,
+	}
 	if c.postgresDisableSSLMode {
-		dsn += "?sslmode=disable"
+		dsn.RawQuery = "sslmode=disable"
 	}
-	return dsn
+	return dsn.String(), nil
 }
 
 func (c *Command) RunE(cmd *cobra.Command, _ []string) error {
+	if err := loadOptions(cmd.Flags()); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancelCause(cmd.Context())
 	defer cancel(nil)
 
-	dsn := c.buildDSN()
+	dsn, err := c.buildDSN()
+	if err != nil {
+		return err
+	}
 	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
 	db := bun.NewDB(sqldb, pgdialect.New())
 	repository := NewRepository(db)
@@ -83,6 +116,17 @@ func (c *Command) RunE(cmd *cobra.Command, _ []string) error {
 	r.Get("/local-problem-answers", controller.listUnscoredAnswersForLocalProblem)
 	r.Get("/answers/{answerID}", controller.getAnswerInformation)
 
+	r.Group(func(r chi.Router) {
+		r.Use(requireAPIToken(c.apiToken))
+
+		r.Post("/problem-environments", controller.createProblemEnvironment)
+		r.Put("/problem-environments/{problemEnvironmentID}", controller.updateProblemEnvironment)
+		r.Patch("/problem-environments/{problemEnvironmentID}/status", controller.updateProblemEnvironmentStatus)
+		r.Post("/problem-environments/acquire", controller.acquireProblemEnvironment)
+		r.Post("/problem-environments/{problemEnvironmentID}/release", controller.releaseProblemEnvironment)
+		r.Delete("/problem-environments/{problemEnvironmentID}", controller.deleteProblemEnvironment)
+	})
+
 	server := Server{
 		ListenAddr: c.listenAddr,
 		Handler:    r,
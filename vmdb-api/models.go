@@ -15,6 +15,12 @@ type Config struct {
 	Vaule string    `bun:"value"`
 }
 
+type Team struct {
+	bun.BaseModel `bun:"table:teams"`
+
+	ID uuid.UUID `bun:"id"`
+}
+
 type Problem struct {
 	bun.BaseModel `bun:"table:problems"`
 
@@ -31,7 +37,7 @@ type ProblemEnvironment struct {
 	User        string    `bun:"user" json:"user"`
 	Password    string    `bun:"password" json:"password"`
 	ProblemID   uuid.UUID `bun:"problem_id" json:"problem_id"`
-	TeamID      uuid.UUID `bun:"team_id" json:"team_id"`
+	TeamID      uuid.UUID `bun:"team_id,nullzero" json:"team_id"`
 	SecretText  string    `bun:"secret_text" json:"secret_text"`
 	Name        string    `bun:"name" json:"name"`
 	Service     string    `bun:"service" json:"service"`
@@ -40,6 +46,17 @@ type ProblemEnvironment struct {
 	UpdatedAt   time.Time `bun:"updated_at" json:"updated_at"`
 }
 
+type ProblemEnvironmentStatusTransition struct {
+	bun.BaseModel `bun:"table:problem_environment_status_transitions"`
+
+	ID                   uuid.UUID `bun:"id"`
+	FromStatus           *string   `bun:"from_status"`
+	ToStatus             string    `bun:"to_status"`
+	ProblemEnvironmentID uuid.UUID `bun:"problem_environment_id"`
+	CreatedAt            time.Time `bun:"created_at"`
+	UpdatedAt            time.Time `bun:"updated_at"`
+}
+
 type Answer struct {
 	bun.BaseModel `bun:"table:answers" json:"-"`
 
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// newTestFlags returns flags parsed from args, with a string flag "host" and a slice flag "teams".
+func newTestFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	t.Helper()
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String(configFlagName, "", "")
+	flags.String("host", "default", "")
+	flags.StringSlice("teams", []string{"staff"}, "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	return flags
+}
+
+// writeTestConfig writes the YAML config file and returns the path.
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadOptions(t *testing.T) {
+	config := writeTestConfig(t, "host: file\nteams:\n  - guest\n  - audience*\n")
+
+	tests := []struct {
+		name      string
+		args      []string
+		env       map[string]string
+		wantHost  string
+		wantTeams []string
+	}{
+		{
+			name:      "default",
+			wantHost:  "default",
+			wantTeams: []string{"staff"},
+		},
+		{
+			name:      "config file over default",
+			args:      []string{"--config", config},
+			wantHost:  "file",
+			wantTeams: []string{"guest", "audience*"},
+		},
+		{
+			name:      "config file given by environment variable",
+			env:       map[string]string{"NETCON_CONFIG": config},
+			wantHost:  "file",
+			wantTeams: []string{"guest", "audience*"},
+		},
+		{
+			name:      "environment variable over config file",
+			args:      []string{"--config", config},
+			env:       map[string]string{"NETCON_HOST": "env", "NETCON_TEAMS": "team01,team02"},
+			wantHost:  "env",
+			wantTeams: []string{"team01", "team02"},
+		},
+		{
+			name:      "flag over environment variable",
+			args:      []string{"--config", config, "--host", "flag", "--teams", "team03"},
+			env:       map[string]string{"NETCON_HOST": "env", "NETCON_TEAMS": "team01,team02"},
+			wantHost:  "flag",
+			wantTeams: []string{"team03"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			flags := newTestFlags(t, tt.args...)
+
+			if err := loadOptions(flags); err != nil {
+				t.Fatalf("loadOptions() = %v", err)
+			}
+
+			if got, _ := flags.GetString("host"); got != tt.wantHost {
+				t.Errorf("host = %q, want %q", got, tt.wantHost)
+			}
+			if got, _ := flags.GetStringSlice("teams"); !slices.Equal(got, tt.wantTeams) {
+				t.Errorf("teams = %q, want %q", got, tt.wantTeams)
+			}
+		})
+	}
+}
+
+func TestLoadOptionsUnknownOption(t *testing.T) {
+	config := writeTestConfig(t, "host: file\nunknown-option: value\n")
+	flags := newTestFlags(t, "--config", config)
+
+	err := loadOptions(flags)
+	if err == nil || !strings.Contains(err.Error(), `unknown option "unknown-option" in config file`) {
+		t.Errorf("loadOptions() = %v, want the unknown option error", err)
+	}
+}
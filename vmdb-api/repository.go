@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
 )
 
 type Repository struct {
@@ -28,9 +30,53 @@ func (r *Repository) findConfigBy(ctx context.Context, key string) (*Config, err
 	return &result, nil
 }
 
-func (r *Repository) listProblemEnvironments(ctx context.Context) ([]ProblemEnvironment, error) {
+// problemEnvironmentFilter narrows down ProblemEnvironments. Zero values mean no filtering.
+type problemEnvironmentFilter struct {
+	ProblemCode string
+	TeamID      *uuid.UUID
+	TeamName    string
+	Status      string
+	Service     string
+	Host        string
+
+	// After is the cursor to paginate. Only ProblemEnvironments whose ID is greater than After are returned.
+	After *uuid.UUID
+
+	// Limit is the max number of ProblemEnvironments to return. 0 means unlimited.
+	Limit int
+}
+
+// listProblemEnvironments lists ProblemEnvironments ordered by ID, so that the cursor keeps stable across requests.
+func (r *Repository) listProblemEnvironments(ctx context.Context, filter problemEnvironmentFilter) ([]ProblemEnvironment, error) {
 	result := []ProblemEnvironment{}
-	if err := r.db.NewSelect().Model(&result).Scan(ctx); err != nil {
+	q := r.db.NewSelect().Model(&result).Order("id")
+
+	if filter.ProblemCode != "" {
+		q = q.Where("problem_id IN (?)", r.db.NewSelect().Column("id").Table("problems").Where("problems.code = ?", filter.ProblemCode))
+	}
+	if filter.TeamID != nil {
+		q = q.Where("team_id = ?", *filter.TeamID)
+	}
+	if filter.TeamName != "" {
+		q = q.Where("team_id IN (?)", r.db.NewSelect().Column("id").Table("teams").Where("teams.name = ?", filter.TeamName))
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	if filter.Service != "" {
+		q = q.Where("service = ?", filter.Service)
+	}
+	if filter.Host != "" {
+		q = q.Where("host = ?", filter.Host)
+	}
+	if filter.After != nil {
+		q = q.Where("id > ?", *filter.After)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+
+	if err := q.Scan(ctx); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -47,6 +93,386 @@ func (r *Repository) findProblemEnvironmentBy(ctx context.Context, name string)
 	return &result, nil
 }
 
+func (r *Repository) findProblemEnvironmentByID(ctx context.Context, id uuid.UUID) (*ProblemEnvironment, error) {
+	var result ProblemEnvironment
+	err := r.db.NewSelect().Model(&result).
+		Where("id = ?", id).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// existsProblemEnvironmentWith reports whether another ProblemEnvironment has the same (problem_id, name, service),
+// which is the unique index of problem_environments.
+func (r *Repository) existsProblemEnvironmentWith(ctx context.Context, problemEnvironment *ProblemEnvironment) (bool, error) {
+	return r.db.NewSelect().Model((*ProblemEnvironment)(nil)).
+		Where("problem_id = ?", problemEnvironment.ProblemID).
+		Where("name = ?", problemEnvironment.Name).
+		Where("service = ?", problemEnvironment.Service).
+		Where("id != ?", problemEnvironment.ID).
+		Exists(ctx)
+}
+
+// createProblemEnvironment inserts the ProblemEnvironment, and records its initial status if any.
+// It returns *statusTransitionError if the initial status is not allowed.
+func (r *Repository) createProblemEnvironment(ctx context.Context, problemEnvironment *ProblemEnvironment) error {
+	if problemEnvironment.InnerStatus != nil {
+		if err := validateStatusTransition(nil, problemEnvironment.InnerStatus); err != nil {
+			return err
+		}
+	}
+
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(problemEnvironment).Exec(ctx); err != nil {
+			return err
+		}
+		if problemEnvironment.InnerStatus == nil {
+			return nil
+		}
+		return recordStatusTransition(ctx, tx, problemEnvironment, nil)
+	})
+}
+
+// updateProblemEnvironment updates all columns except id and created_at.
+// If the status is changed, the transition is validated and recorded in the same transaction.
+// It returns sql.ErrNoRows if the ProblemEnvironment doesn't exist, and *statusTransitionError if the transition is not allowed.
+func (r *Repository) updateProblemEnvironment(ctx context.Context, problemEnvironment *ProblemEnvironment) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var current ProblemEnvironment
+		err := tx.NewSelect().Model(&current).
+			Column("status").
+			Where("id = ?", problemEnvironment.ID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		statusChanged := isStatusChanged(current.InnerStatus, problemEnvironment.InnerStatus)
+		if statusChanged {
+			if err := validateStatusTransition(current.InnerStatus, problemEnvironment.InnerStatus); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.NewUpdate().Model(problemEnvironment).
+			ExcludeColumn("id", "created_at").
+			Where("id = ?", problemEnvironment.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !statusChanged {
+			return nil
+		}
+		return recordStatusTransition(ctx, tx, problemEnvironment, current.InnerStatus)
+	})
+}
+
+// updateProblemEnvironmentStatus moves the ProblemEnvironment to the status, and records the transition.
+// The row is locked during the transaction, so that concurrent transitions are validated one by one.
+// Moving to the current status is a no-op, so that clients can retry safely.
+// It returns sql.ErrNoRows if the ProblemEnvironment doesn't exist, and *statusTransitionError if the transition is not allowed.
+func (r *Repository) updateProblemEnvironmentStatus(ctx context.Context, id uuid.UUID, status string, now time.Time) (*ProblemEnvironment, error) {
+	var result ProblemEnvironment
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().Model(&result).
+			Where("id = ?", id).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		from := result.InnerStatus
+		if !isStatusChanged(from, &status) {
+			return nil
+		}
+		if err := validateStatusTransition(from, &status); err != nil {
+			return err
+		}
+
+		result.InnerStatus = &status
+		result.UpdatedAt = now
+		_, err = tx.NewUpdate().Model(&result).
+			Column("status", "updated_at").
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		return recordStatusTransition(ctx, tx, &result, from)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+var (
+	errNoProblemEnvironmentAvailable     = errors.New("no problem environment is available")
+	errProblemEnvironmentAlreadyAssigned = errors.New("the team is already challenging another problem")
+	errProblemEnvironmentNotAssigned     = errors.New("the problem environment is not assigned to any team")
+)
+
+// maxAcquireAttempts is the max number of VMs tried in an acquisition, in case a VM turns out not to be free after locking it.
+const maxAcquireAttempts = 3
+
+// acquireProblemEnvironments assigns a READY VM of the problem to the team, and moves it to UNDER_CHALLENGE.
+// A VM has a ProblemEnvironment for each service with the same name, and all of them are assigned together.
+//
+// Like AcquireProblemEnvironment of the score server, the team can challenge only one problem at a time:
+// it returns the assigned ProblemEnvironments if the team is already challenging the problem, and
+// errProblemEnvironmentAlreadyAssigned if the team is challenging another one.
+// It returns sql.ErrNoRows if the team doesn't exist, and errNoProblemEnvironmentAvailable if no VM is free.
+func (r *Repository) acquireProblemEnvironments(ctx context.Context, problemID, teamID uuid.UUID, now time.Time) ([]ProblemEnvironment, error) {
+	var result []ProblemEnvironment
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the team to serialize acquisitions by the same team
+		var team Team
+		err := tx.NewSelect().Model(&team).
+			Column("id").
+			Where("id = ?", teamID).
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		var assigned []ProblemEnvironment
+		err = tx.NewSelect().Model(&assigned).
+			Where("team_id = ?", teamID).
+			Where("status = ?", statusUnderChallenge).
+			Order("name", "service").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(assigned) > 0 {
+			for _, problemEnvironment := range assigned {
+				if problemEnvironment.ProblemID != problemID {
+					return errProblemEnvironmentAlreadyAssigned
+				}
+			}
+			result = assigned
+			return nil
+		}
+
+		skippedNames := []string{}
+		for range maxAcquireAttempts {
+			name, err := findFreeProblemEnvironmentName(ctx, tx, problemID, skippedNames)
+			if err != nil {
+				return err
+			}
+
+			group, err := lockProblemEnvironmentGroup(ctx, tx, problemID, name)
+			if err != nil {
+				return err
+			}
+
+			// Another transaction might have changed the other services of the VM before they are locked.
+			free := len(group) > 0
+			for _, problemEnvironment := range group {
+				if problemEnvironment.TeamID != uuid.Nil || problemEnvironment.InnerStatus == nil || *problemEnvironment.InnerStatus != statusReady {
+					free = false
+				}
+			}
+			if !free {
+				skippedNames = append(skippedNames, name)
+				continue
+			}
+
+			for i := range group {
+				group[i].TeamID = teamID
+				if err := transitProblemEnvironmentInGroup(ctx, tx, &group[i], statusUnderChallenge, now); err != nil {
+					return err
+				}
+			}
+			result = group
+			return nil
+		}
+
+		return errNoProblemEnvironmentAvailable
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// findFreeProblemEnvironmentName finds the name of a VM whose ProblemEnvironments are all READY and not assigned.
+//
+// Every acquisition locks the ProblemEnvironment with the first service of the VM before the others,
+// so VMs being acquired by other transactions are skipped by SKIP LOCKED without deadlocks.
+func findFreeProblemEnvironmentName(ctx context.Context, tx bun.Tx, problemID uuid.UUID, skippedNames []string) (string, error) {
+	var head ProblemEnvironment
+	q := tx.NewSelect().Model(&head).
+		Column("name").
+		Where("problem_id = ?", problemID).
+		Where("team_id IS NULL").
+		Where("status = ?", statusReady).
+		Where("service = (?)", tx.NewSelect().
+			ColumnExpr("MIN(sibling.service)").
+			TableExpr("problem_environments AS sibling").
+			Where("sibling.problem_id = problem_environment.problem_id").
+			Where("sibling.name = problem_environment.name")).
+		Where("NOT EXISTS (?)", tx.NewSelect().
+			ColumnExpr("1").
+			TableExpr("problem_environments AS sibling").
+			Where("sibling.problem_id = problem_environment.problem_id").
+			Where("sibling.name = problem_environment.name").
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.
+					Where("sibling.team_id IS NOT NULL").
+					WhereOr("sibling.status IS DISTINCT FROM ?", statusReady)
+			})).
+		Order("name").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+	if len(skippedNames) > 0 {
+		q = q.Where("name NOT IN (?)", bun.In(skippedNames))
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errNoProblemEnvironmentAvailable
+		}
+		return "", err
+	}
+	return head.Name, nil
+}
+
+// lockProblemEnvironmentGroup locks all ProblemEnvironments of the VM, in the order of services to avoid deadlocks.
+func lockProblemEnvironmentGroup(ctx context.Context, tx bun.Tx, problemID uuid.UUID, name string) ([]ProblemEnvironment, error) {
+	group := []ProblemEnvironment{}
+	err := tx.NewSelect().Model(&group).
+		Where("problem_id = ?", problemID).
+		Where("name = ?", name).
+		Order("service").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// transitProblemEnvironmentInGroup saves team_id and the status of the locked ProblemEnvironment, and records the transition.
+func transitProblemEnvironmentInGroup(ctx context.Context, tx bun.Tx, problemEnvironment *ProblemEnvironment, status string, now time.Time) error {
+	from := problemEnvironment.InnerStatus
+	problemEnvironment.InnerStatus = &status
+	problemEnvironment.UpdatedAt = now
+	_, err := tx.NewUpdate().Model(problemEnvironment).
+		Column("team_id", "status", "updated_at").
+		Where("id = ?", problemEnvironment.ID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	return recordStatusTransition(ctx, tx, problemEnvironment, from)
+}
+
+// releaseProblemEnvironments unassigns the VM of the ProblemEnvironment from the team, and moves it back to NOT_READY.
+// All ProblemEnvironments of the VM assigned to the same team are released together.
+// It returns sql.ErrNoRows if the ProblemEnvironment doesn't exist, errProblemEnvironmentNotAssigned if no team has it,
+// and *statusTransitionError if any of them is neither UNDER_CHALLENGE nor ABANDONED.
+func (r *Repository) releaseProblemEnvironments(ctx context.Context, id uuid.UUID, now time.Time) ([]ProblemEnvironment, error) {
+	var result []ProblemEnvironment
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var target ProblemEnvironment
+		err := tx.NewSelect().Model(&target).
+			Column("problem_id", "name").
+			Where("id = ?", id).
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		group, err := lockProblemEnvironmentGroup(ctx, tx, target.ProblemID, target.Name)
+		if err != nil {
+			return err
+		}
+
+		// The ProblemEnvironment is re-read after locking, as it might have been changed in the meantime.
+		teamID := uuid.Nil
+		found := false
+		for _, problemEnvironment := range group {
+			if problemEnvironment.ID == id {
+				teamID = problemEnvironment.TeamID
+				found = true
+			}
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+		if teamID == uuid.Nil {
+			return errProblemEnvironmentNotAssigned
+		}
+
+		status := statusNotReady
+		for _, problemEnvironment := range group {
+			if problemEnvironment.TeamID != teamID {
+				continue
+			}
+			if err := validateStatusTransition(problemEnvironment.InnerStatus, &status); err != nil {
+				return err
+			}
+
+			problemEnvironment.TeamID = uuid.Nil
+			if err := transitProblemEnvironmentInGroup(ctx, tx, &problemEnvironment, statusNotReady, now); err != nil {
+				return err
+			}
+			result = append(result, problemEnvironment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// deleteProblemEnvironment deletes the ProblemEnvironment with its status transitions.
+// It returns sql.ErrNoRows if the ProblemEnvironment doesn't exist.
+func (r *Repository) deleteProblemEnvironment(ctx context.Context, id uuid.UUID) error {
+	return r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().Model((*ProblemEnvironmentStatusTransition)(nil)).
+			Where("problem_environment_id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewDelete().Model((*ProblemEnvironment)(nil)).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return expectRowsAffected(res)
+	})
+}
+
+// recordStatusTransition records that the ProblemEnvironment has moved from the status to its current status.
+// The timestamps are the same as updated_at of the ProblemEnvironment.
+func recordStatusTransition(ctx context.Context, db bun.IDB, problemEnvironment *ProblemEnvironment, from *string) error {
+	transition := ProblemEnvironmentStatusTransition{
+		ID:                   uuid.New(),
+		FromStatus:           from,
+		ToStatus:             *problemEnvironment.InnerStatus,
+		ProblemEnvironmentID: problemEnvironment.ID,
+		CreatedAt:            problemEnvironment.UpdatedAt,
+		UpdatedAt:            problemEnvironment.UpdatedAt,
+	}
+	_, err := db.NewInsert().Model(&transition).Exec(ctx)
+	return err
+}
+
 func (r *Repository) findProblemBy(ctx context.Context, problemID uuid.UUID) (*Problem, error) {
 	var result Problem
 	err := r.db.NewSelect().Model(&result).
@@ -58,6 +484,17 @@ func (r *Repository) findProblemBy(ctx context.Context, problemID uuid.UUID) (*P
 	return &result, nil
 }
 
+func (r *Repository) findTeamBy(ctx context.Context, teamID uuid.UUID) (*Team, error) {
+	var result Team
+	err := r.db.NewSelect().Model(&result).
+		Where("id = ?", teamID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (r *Repository) findProblemByCode(ctx context.Context, code string) (*Problem, error) {
 	var result Problem
 	err := r.db.NewSelect().Model(&result).
@@ -110,3 +547,55 @@ func (r *Repository) findLatestAnswerFor(ctx context.Context, problemID uuid.UUI
 	}
 	return &result, nil
 }
+
+// problemTeamKey is used to look up Answers by the pair of problem and team.
+type problemTeamKey struct {
+	ProblemID uuid.UUID
+	TeamID    uuid.UUID
+}
+
+// listLatestAnswersFor finds the latest Answer for each pair of problem and team in a single query.
+// Pairs without any Answer are not contained in the result.
+func (r *Repository) listLatestAnswersFor(ctx context.Context, keys []problemTeamKey) (map[problemTeamKey]Answer, error) {
+	result := map[problemTeamKey]Answer{}
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	pairs := make([][]any, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, []any{key.ProblemID, key.TeamID})
+	}
+
+	answers := []Answer{}
+	err := r.db.NewSelect().Model(&answers).
+		DistinctOn("problem_id, team_id").
+		Where("(problem_id, team_id) IN (?)", bun.In(pairs)).
+		Order("problem_id", "team_id", "created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, answer := range answers {
+		result[problemTeamKey{ProblemID: answer.ProblemID, TeamID: answer.TeamID}] = answer
+	}
+	return result, nil
+}
+
+func expectRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is caused by a unique index of PostgreSQL.
+func isUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Statuses of ProblemEnvironment used by the score server.
+const (
+	statusNotReady       = "NOT_READY"
+	statusReady          = "READY"
+	statusUnderChallenge = "UNDER_CHALLENGE"
+	statusUnderScoring   = "UNDER_SCORING"
+	statusAbandoned      = "ABANDONED"
+)
+
+// statusTransitions maps each status to the statuses a ProblemEnvironment can move to.
+// The empty key is for ProblemEnvironments without status, including the ones just registered.
+// The score server moves UNDER_SCORING back to UNDER_CHALLENGE after scoring, or to ABANDONED on a perfect score.
+// Released environments go back to NOT_READY, so that they are reprovisioned before the next team uses them.
+// They are released after the team abandons them, or while the team is challenging the problem.
+// UNDER_SCORING can't be released, as the environment is kept until the answer is scored.
+var statusTransitions = map[string][]string{
+	"":                   {statusNotReady, statusReady},
+	statusNotReady:       {statusReady, statusAbandoned},
+	statusReady:          {statusUnderChallenge, statusAbandoned},
+	statusUnderChallenge: {statusUnderScoring, statusAbandoned, statusNotReady},
+	statusUnderScoring:   {statusUnderChallenge, statusAbandoned},
+	statusAbandoned:      {statusNotReady},
+}
+
+// statusTransitionError is returned when a ProblemEnvironment can't move to the requested status.
+type statusTransitionError struct {
+	From    *string
+	To      string
+	Allowed []string
+}
+
+func (e *statusTransitionError) Error() string {
+	from, to := "(none)", "(none)"
+	if e.From != nil {
+		from = *e.From
+	}
+	if e.To != "" {
+		to = e.To
+	}
+	return fmt.Sprintf("cannot transit status from %s to %s", from, to)
+}
+
+// allowedStatusesFrom returns the statuses a ProblemEnvironment in the status can move to.
+// Statuses unknown to vmdb-api (e.g. written by hand) are treated as no status, so that they can be recovered.
+func allowedStatusesFrom(from *string) []string {
+	if from != nil {
+		if allowed, ok := statusTransitions[*from]; ok {
+			return allowed
+		}
+	}
+	return statusTransitions[""]
+}
+
+// validateStatusTransition returns *statusTransitionError if the transition is not allowed.
+// The status can't be cleared once it's set, so nil is never allowed as the destination.
+func validateStatusTransition(from, to *string) error {
+	allowed := allowedStatusesFrom(from)
+	if to == nil || !slices.Contains(allowed, *to) {
+		err := &statusTransitionError{From: from, Allowed: allowed}
+		if to != nil {
+			err.To = *to
+		}
+		return err
+	}
+	return nil
+}
+
+// isStatusChanged reports whether the status differs, treating nil as no status.
+func isStatusChanged(from, to *string) bool {
+	if from == nil || to == nil {
+		return from != to
+	}
+	return *from != *to
+}
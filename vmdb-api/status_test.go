@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateStatusTransition(t *testing.T) {
+	status := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		from        *string
+		to          *string
+		wantAllowed []string // nil if the transition is allowed
+	}{
+		{
+			name: "no status to READY",
+			from: nil,
+			to:   status(statusReady),
+		},
+		{
+			name: "READY to UNDER_CHALLENGE",
+			from: status(statusReady),
+			to:   status(statusUnderChallenge),
+		},
+		{
+			name: "UNDER_SCORING back to UNDER_CHALLENGE",
+			from: status(statusUnderScoring),
+			to:   status(statusUnderChallenge),
+		},
+		{
+			name: "UNDER_CHALLENGE released to NOT_READY",
+			from: status(statusUnderChallenge),
+			to:   status(statusNotReady),
+		},
+		{
+			name: "ABANDONED released to NOT_READY",
+			from: status(statusAbandoned),
+			to:   status(statusNotReady),
+		},
+		{
+			name:        "no status to UNDER_CHALLENGE",
+			from:        nil,
+			to:          status(statusUnderChallenge),
+			wantAllowed: statusTransitions[""],
+		},
+		{
+			name:        "READY to UNDER_SCORING",
+			from:        status(statusReady),
+			to:          status(statusUnderScoring),
+			wantAllowed: statusTransitions[statusReady],
+		},
+		{
+			name:        "UNDER_SCORING to NOT_READY",
+			from:        status(statusUnderScoring),
+			to:          status(statusNotReady),
+			wantAllowed: statusTransitions[statusUnderScoring],
+		},
+		{
+			name: "unknown status recovers as no status",
+			from: status("BROKEN"),
+			to:   status(statusNotReady),
+		},
+		{
+			name:        "unknown status can't move beyond no status",
+			from:        status("BROKEN"),
+			to:          status(statusUnderChallenge),
+			wantAllowed: statusTransitions[""],
+		},
+		{
+			name:        "unknown status as the destination",
+			from:        status(statusReady),
+			to:          status("BROKEN"),
+			wantAllowed: statusTransitions[statusReady],
+		},
+		{
+			name:        "nil as the destination",
+			from:        status(statusReady),
+			to:          nil,
+			wantAllowed: statusTransitions[statusReady],
+		},
+		{
+			name:        "nil to nil",
+			from:        nil,
+			to:          nil,
+			wantAllowed: statusTransitions[""],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStatusTransition(tt.from, tt.to)
+			if tt.wantAllowed == nil {
+				if err != nil {
+					t.Errorf("validateStatusTransition() = %v, want nil", err)
+				}
+				return
+			}
+
+			var transitionErr *statusTransitionError
+			if !errors.As(err, &transitionErr) {
+				t.Fatalf("validateStatusTransition() = %v, want *statusTransitionError", err)
+			}
+			if transitionErr.From != tt.from {
+				t.Errorf("From = %v, want %v", transitionErr.From, tt.from)
+			}
+			if tt.to == nil && transitionErr.To != "" || tt.to != nil && transitionErr.To != *tt.to {
+				t.Errorf("To = %q, want %v", transitionErr.To, tt.to)
+			}
+			if !slices.Equal(transitionErr.Allowed, tt.wantAllowed) {
+				t.Errorf("Allowed = %v, want %v", transitionErr.Allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestStatusTransitionsAreKnown(t *testing.T) {
+	// Every destination must have its own row, so that environments never get stuck.
+	for from, allowed := range statusTransitions {
+		for _, to := range allowed {
+			if _, ok := statusTransitions[to]; !ok {
+				t.Errorf("%s can move to %s, which has no transitions", from, to)
+			}
+		}
+	}
+}
+
+func TestIsStatusChanged(t *testing.T) {
+	status := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		from *string
+		to   *string
+		want bool
+	}{
+		{name: "nil to nil", from: nil, to: nil, want: false},
+		{name: "nil to status", from: nil, to: status(statusReady), want: true},
+		{name: "status to nil", from: status(statusReady), to: nil, want: true},
+		{name: "same status", from: status(statusReady), to: status(statusReady), want: false},
+		{name: "different status", from: status(statusReady), to: status(statusUnderChallenge), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStatusChanged(tt.from, tt.to); got != tt.want {
+				t.Errorf("isStatusChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}